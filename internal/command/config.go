@@ -0,0 +1,27 @@
+package command
+
+import (
+	"io"
+
+	"github.com/notomo/wsxhub/internal/domain"
+)
+
+// ConfigCheckCommand :
+type ConfigCheckCommand struct {
+	ConfigFactory domain.ConfigFactory
+	Path          string
+	OutputWriter  io.Writer
+}
+
+// Run : validates the config file and then outputs "ok"
+func (cmd *ConfigCheckCommand) Run() error {
+	if _, err := cmd.ConfigFactory.Config(cmd.Path); err != nil {
+		return err
+	}
+
+	if _, err := cmd.OutputWriter.Write([]byte("ok")); err != nil {
+		return err
+	}
+
+	return nil
+}
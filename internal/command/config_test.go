@@ -0,0 +1,61 @@
+package command
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/notomo/wsxhub/internal/domain"
+	"github.com/notomo/wsxhub/internal/mock"
+)
+
+func TestConfigCheckRun(t *testing.T) {
+	factory := &mock.FakeConfigFactory{
+		FakeConfig: func(path string) (*domain.Config, error) {
+			if path != "wsxhub.json" {
+				t.Errorf("unexpected path: %s", path)
+			}
+			return &domain.Config{}, nil
+		},
+	}
+
+	writer := &bytes.Buffer{}
+	cmd := ConfigCheckCommand{
+		ConfigFactory: factory,
+		Path:          "wsxhub.json",
+		OutputWriter:  writer,
+	}
+
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("should not be error: %v", err)
+	}
+
+	got := writer.String()
+	want := "ok"
+	if got != want {
+		t.Errorf("want %v, but %v:", want, got)
+	}
+}
+
+func TestConfigCheckRunWithInvalidConfig(t *testing.T) {
+	factory := &mock.FakeConfigFactory{
+		FakeConfig: func(path string) (*domain.Config, error) {
+			return nil, errors.New("invalid")
+		},
+	}
+
+	writer := &bytes.Buffer{}
+	cmd := ConfigCheckCommand{
+		ConfigFactory: factory,
+		Path:          "wsxhub.json",
+		OutputWriter:  writer,
+	}
+
+	if err := cmd.Run(); err == nil {
+		t.Fatal("should be error")
+	}
+
+	if got := writer.String(); got != "" {
+		t.Errorf("should output nothing, but %v", got)
+	}
+}
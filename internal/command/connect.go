@@ -0,0 +1,74 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/notomo/wsxhub/internal/domain"
+)
+
+// closeWaitTimeout : how long to wait the close frame from the server after the input ends
+const closeWaitTimeout = 1 * time.Second
+
+// ConnectCommand :
+type ConnectCommand struct {
+	WebsocketClientFactory domain.WebsocketClientFactory
+	MessageFactory         domain.MessageFactory
+	InputReader            io.Reader
+	OutputWriter           io.Writer
+	ErrorWriter            io.Writer
+}
+
+// Run : sends each json value in the input and outputs the received messages line by line over one connection
+// The connection is closed after the input ends, or the command ends when the server closes the connection.
+// The invalid values in the input are reported without stopping.
+func (cmd *ConnectCommand) Run() error {
+	client, err := cmd.WebsocketClientFactory.Client()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	receiving := make(chan error, 1)
+	go func() {
+		receiving <- client.Receive(0, func(message []byte) error {
+			_, err := cmd.OutputWriter.Write(append(message, '\n'))
+			return err
+		})
+	}()
+
+	sending := make(chan streamResult, 1)
+	go func() {
+		result := streamResult{}
+		result.err = cmd.MessageFactory.FromStream(cmd.InputReader, func(message domain.Message, err error) error {
+			if err != nil {
+				result.invalid++
+				_, err := fmt.Fprintln(cmd.ErrorWriter, err)
+				return err
+			}
+			return client.Send(message.Bytes())
+		})
+		sending <- result
+	}()
+
+	select {
+	case err := <-receiving:
+		return err
+	case result := <-sending:
+		if result.err != nil {
+			return result.err
+		}
+		if err := client.SendClose(domain.CloseNormalClosure, ""); err != nil {
+			return err
+		}
+		select {
+		case err := <-receiving:
+			if err != nil {
+				return err
+			}
+		case <-time.After(closeWaitTimeout):
+		}
+		return invalidMessagesError(result.invalid)
+	}
+}
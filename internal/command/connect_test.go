@@ -0,0 +1,121 @@
+package command
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/notomo/wsxhub/internal/domain"
+	"github.com/notomo/wsxhub/internal/mock"
+)
+
+func TestConnectRun(t *testing.T) {
+	newMessage := func(s string) domain.Message {
+		return &mock.FakeMessage{
+			FakeBytes: func() []byte {
+				return []byte(s)
+			},
+		}
+	}
+
+	t.Run("input ends", func(t *testing.T) {
+		received := make(chan bool)
+		msgFactory := &mock.FakeMessageFactory{
+			FakeFromStream: func(inputReader io.Reader, callback func(domain.Message, error) error) error {
+				<-received
+				if err := callback(newMessage("1"), nil); err != nil {
+					return err
+				}
+				return callback(newMessage("2"), nil)
+			},
+		}
+
+		sent := []string{}
+		closeCodes := []int{}
+		closed := make(chan bool)
+		client := &mock.FakeWebsocketClient{
+			FakeClose: func() error {
+				return nil
+			},
+			FakeSend: func(bytes []byte) error {
+				sent = append(sent, string(bytes))
+				return nil
+			},
+			FakeSendClose: func(code int, reason string) error {
+				closeCodes = append(closeCodes, code)
+				close(closed)
+				return nil
+			},
+			FakeReceive: func(timeout time.Duration, callback func([]byte) error) error {
+				if err := callback([]byte("event")); err != nil {
+					return err
+				}
+				close(received)
+				<-closed
+				return nil
+			},
+		}
+
+		factory := &mock.FakeWebsocketClientFactory{
+			FakeClient: func() (domain.WebsocketClient, error) {
+				return client, nil
+			},
+		}
+
+		writer := &bytes.Buffer{}
+		cmd := ConnectCommand{
+			WebsocketClientFactory: factory,
+			MessageFactory:         msgFactory,
+			OutputWriter:           writer,
+		}
+
+		if err := cmd.Run(); err != nil {
+			t.Fatalf("should not be error: %v", err)
+		}
+
+		if got, want := writer.String(), "event\n"; got != want {
+			t.Errorf("want %v, but %v:", want, got)
+		}
+		if want := []string{"1", "2"}; !reflect.DeepEqual(sent, want) {
+			t.Errorf("want %v, but %v:", want, sent)
+		}
+		if want := []int{domain.CloseNormalClosure}; !reflect.DeepEqual(closeCodes, want) {
+			t.Errorf("want %v, but %v:", want, closeCodes)
+		}
+	})
+
+	t.Run("closed by server", func(t *testing.T) {
+		msgFactory := &mock.FakeMessageFactory{
+			FakeFromStream: func(inputReader io.Reader, callback func(domain.Message, error) error) error {
+				select {}
+			},
+		}
+
+		client := &mock.FakeWebsocketClient{
+			FakeClose: func() error {
+				return nil
+			},
+			FakeReceive: func(timeout time.Duration, callback func([]byte) error) error {
+				return nil
+			},
+		}
+
+		factory := &mock.FakeWebsocketClientFactory{
+			FakeClient: func() (domain.WebsocketClient, error) {
+				return client, nil
+			},
+		}
+
+		cmd := ConnectCommand{
+			WebsocketClientFactory: factory,
+			MessageFactory:         msgFactory,
+			OutputWriter:           &bytes.Buffer{},
+		}
+
+		if err := cmd.Run(); err != nil {
+			t.Fatalf("should not be error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,138 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/notomo/wsxhub/internal"
+)
+
+const (
+	// ExitCodeError : the other errors
+	ExitCodeError = 1
+	// ExitCodeBadInput : the invalid json in the input or the invalid flag value
+	ExitCodeBadInput = 2
+	// ExitCodeConnectionRefused : the server can't be reached like not running
+	ExitCodeConnectionRefused = 3
+	// ExitCodeConnectTimeout : connecting to the server including the handshake timed out
+	ExitCodeConnectTimeout = 4
+	// ExitCodeWriteTimeout : sending a message timed out
+	ExitCodeWriteTimeout = 5
+	// ExitCodeReplyTimeout : the first reply or message didn't arrive in time
+	ExitCodeReplyTimeout = 6
+	// ExitCodeIdleTimeout : the next message didn't arrive in time
+	ExitCodeIdleTimeout = 7
+	// ExitCodeHandshakeRejected : the server rejected the handshake like the invalid token or origin
+	ExitCodeHandshakeRejected = 8
+	// ExitCodeRemoteClosed : the server closed the connection before the expected messages or abnormally
+	ExitCodeRemoteClosed = 9
+)
+
+var exitCodes = map[error]int{
+	internal.ErrConnectTimeout: ExitCodeConnectTimeout,
+	internal.ErrWriteTimeout:   ExitCodeWriteTimeout,
+	internal.ErrReplyTimeout:   ExitCodeReplyTimeout,
+	internal.ErrIdleTimeout:    ExitCodeIdleTimeout,
+	internal.ErrRemoteClosed:   ExitCodeRemoteClosed,
+}
+
+var exitCodeKinds = map[int]string{
+	ExitCodeError:             "error",
+	ExitCodeBadInput:          "badInput",
+	ExitCodeConnectionRefused: "connectionRefused",
+	ExitCodeConnectTimeout:    "connectTimeout",
+	ExitCodeWriteTimeout:      "writeTimeout",
+	ExitCodeReplyTimeout:      "replyTimeout",
+	ExitCodeIdleTimeout:       "idleTimeout",
+	ExitCodeHandshakeRejected: "handshakeRejected",
+	ExitCodeRemoteClosed:      "remoteClosed",
+}
+
+// ExitCode : returns the exit code for the error returned by the commands
+func ExitCode(err error) int {
+	switch err := err.(type) {
+	case nil:
+		return 0
+	case *internal.InputError:
+		return ExitCodeBadInput
+	case *internal.ConnectionError:
+		return ExitCodeConnectionRefused
+	case *internal.HandshakeError:
+		return ExitCodeHandshakeRejected
+	case *internal.CloseError:
+		return ExitCodeRemoteClosed
+	default:
+		if code, ok := exitCodes[err]; ok {
+			return code
+		}
+		return ExitCodeError
+	}
+}
+
+// ErrorFormat :
+type ErrorFormat string
+
+var (
+	// ErrorFormatText : the error message as is
+	ErrorFormatText = ErrorFormat("text")
+	// ErrorFormatJSON : `{"code":3,"kind":"connectionRefused","message":"..."}` for the plugins
+	ErrorFormatJSON = ErrorFormat("json")
+)
+
+// ParseErrorFormat :
+func ParseErrorFormat(value string) (ErrorFormat, error) {
+	for _, format := range []ErrorFormat{ErrorFormatText, ErrorFormatJSON} {
+		if value == string(format) {
+			return format, nil
+		}
+	}
+	return ErrorFormatText, fmt.Errorf("invalid error format: %s", value)
+}
+
+// ErrorOutput : the structured error written in the json format
+type ErrorOutput struct {
+	Code    int    `json:"code"`
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+	// Status : the http status of the rejected handshake
+	Status int `json:"status,omitempty"`
+	// Body : the response body of the rejected handshake
+	Body string `json:"body,omitempty"`
+	// CloseCode : the websocket close code sent by the server
+	CloseCode   int    `json:"closeCode,omitempty"`
+	CloseReason string `json:"closeReason,omitempty"`
+}
+
+// NewErrorOutput :
+func NewErrorOutput(err error) ErrorOutput {
+	code := ExitCode(err)
+	output := ErrorOutput{
+		Code:    code,
+		Kind:    exitCodeKinds[code],
+		Message: err.Error(),
+	}
+	switch err := err.(type) {
+	case *internal.HandshakeError:
+		output.Status = err.StatusCode
+		output.Body = err.Body
+	case *internal.CloseError:
+		output.CloseCode = err.Code
+		output.CloseReason = err.Reason
+	}
+	return output
+}
+
+// WriteError : writes the error in the format as a line
+func WriteError(writer io.Writer, err error, format ErrorFormat) error {
+	if format != ErrorFormatJSON {
+		_, err := fmt.Fprintln(writer, err)
+		return err
+	}
+	bytes, err := json.Marshal(NewErrorOutput(err))
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(append(bytes, '\n'))
+	return err
+}
@@ -0,0 +1,85 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/notomo/wsxhub/internal"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "nil", err: nil, want: 0},
+		{name: "connect timeout", err: internal.ErrConnectTimeout, want: ExitCodeConnectTimeout},
+		{name: "write timeout", err: internal.ErrWriteTimeout, want: ExitCodeWriteTimeout},
+		{name: "reply timeout", err: internal.ErrReplyTimeout, want: ExitCodeReplyTimeout},
+		{name: "idle timeout", err: internal.ErrIdleTimeout, want: ExitCodeIdleTimeout},
+		{name: "bad input", err: &internal.InputError{Err: fmt.Errorf("invalid")}, want: ExitCodeBadInput},
+		{name: "connection refused", err: &internal.ConnectionError{Err: fmt.Errorf("refused")}, want: ExitCodeConnectionRefused},
+		{name: "handshake rejected", err: &internal.HandshakeError{StatusCode: 401}, want: ExitCodeHandshakeRejected},
+		{name: "remote closed", err: internal.ErrRemoteClosed, want: ExitCodeRemoteClosed},
+		{name: "closed abnormally", err: &internal.CloseError{Code: 1009}, want: ExitCodeRemoteClosed},
+		{name: "other", err: fmt.Errorf("other"), want: ExitCodeError},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			if got := ExitCode(test.err); got != test.want {
+				t.Errorf("want %v, but %v:", test.want, got)
+			}
+		})
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		format ErrorFormat
+		want   string
+	}{
+		{
+			name:   "text",
+			err:    internal.ErrReplyTimeout,
+			format: ErrorFormatText,
+			want:   "reply timeout\n",
+		},
+		{
+			name:   "json",
+			err:    internal.ErrReplyTimeout,
+			format: ErrorFormatJSON,
+			want:   `{"code":6,"kind":"replyTimeout","message":"reply timeout"}` + "\n",
+		},
+		{
+			name:   "json with handshake status",
+			err:    &internal.HandshakeError{StatusCode: 401, Body: "unauthorized\n", Err: fmt.Errorf("websocket: bad handshake")},
+			format: ErrorFormatJSON,
+			want:   `{"code":8,"kind":"handshakeRejected","message":"websocket: bad handshake: unauthorized\n","status":401,"body":"unauthorized\n"}` + "\n",
+		},
+		{
+			name:   "json with close code",
+			err:    &internal.CloseError{Code: 1009, Reason: "too big"},
+			format: ErrorFormatJSON,
+			want:   `{"code":9,"kind":"remoteClosed","message":"closed by the server: 1009 too big","closeCode":1009,"closeReason":"too big"}` + "\n",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			writer := &bytes.Buffer{}
+			if err := WriteError(writer, test.err, test.format); err != nil {
+				t.Fatalf("should not be error: %v", err)
+			}
+			if got := writer.String(); got != test.want {
+				t.Errorf("want %v, but %v:", test.want, got)
+			}
+		})
+	}
+}
@@ -1,8 +1,10 @@
 package command
 
 import (
+	"fmt"
 	"io"
 
+	"github.com/notomo/wsxhub/internal"
 	"github.com/notomo/wsxhub/internal/domain"
 )
 
@@ -11,9 +13,12 @@ type NotifyCommand struct {
 	WebsocketClientFactory domain.WebsocketClientFactory
 	MessageFactory         domain.MessageFactory
 	InputReader            io.Reader
+	Stream                 bool
+	ErrorWriter            io.Writer
 }
 
 // Run : notifies a message to wsxhub server, but doesn't wait a response
+// In the stream mode, notifies each json value in the input as it arrives.
 func (cmd *NotifyCommand) Run() error {
 	client, err := cmd.WebsocketClientFactory.Client()
 	if err != nil {
@@ -21,9 +26,13 @@ func (cmd *NotifyCommand) Run() error {
 	}
 	defer client.Close()
 
+	if cmd.Stream {
+		return cmd.stream(client)
+	}
+
 	message, err := cmd.MessageFactory.FromReader(cmd.InputReader)
 	if err != nil {
-		return err
+		return &internal.InputError{Err: err}
 	}
 
 	if err := client.Send(message.Bytes()); err != nil {
@@ -32,3 +41,27 @@ func (cmd *NotifyCommand) Run() error {
 
 	return nil
 }
+
+func (cmd *NotifyCommand) stream(client domain.WebsocketClient) error {
+	invalid := 0
+	if err := cmd.MessageFactory.FromStream(cmd.InputReader, func(message domain.Message, err error) error {
+		if err != nil {
+			invalid++
+			_, err := fmt.Fprintln(cmd.ErrorWriter, err)
+			return err
+		}
+		return client.Send(message.Bytes())
+	}); err != nil {
+		return err
+	}
+
+	return invalidMessagesError(invalid)
+}
+
+// invalidMessagesError : reports the invalid messages skipped in the stream mode after the stream ends
+func invalidMessagesError(count int) error {
+	if count == 0 {
+		return nil
+	}
+	return &internal.InputError{Err: fmt.Errorf("skipped invalid messages: %d", count)}
+}
@@ -1,7 +1,10 @@
 package command
 
 import (
+	"bytes"
+	"fmt"
 	"io"
+	"reflect"
 	"testing"
 
 	"github.com/notomo/wsxhub/internal/domain"
@@ -50,3 +53,61 @@ func TestNotifyRun(t *testing.T) {
 		t.Fatalf("should not be error: %v", err)
 	}
 }
+
+func TestNotifyRunStream(t *testing.T) {
+	newMessage := func(s string) domain.Message {
+		return &mock.FakeMessage{
+			FakeBytes: func() []byte {
+				return []byte(s)
+			},
+		}
+	}
+
+	msgFactory := &mock.FakeMessageFactory{
+		FakeFromStream: func(inputReader io.Reader, callback func(domain.Message, error) error) error {
+			if err := callback(newMessage("1"), nil); err != nil {
+				return err
+			}
+			if err := callback(nil, fmt.Errorf("line 2: invalid")); err != nil {
+				return err
+			}
+			return callback(newMessage("3"), nil)
+		},
+	}
+
+	sent := []string{}
+	client := &mock.FakeWebsocketClient{
+		FakeClose: func() error {
+			return nil
+		},
+		FakeSend: func(bytes []byte) error {
+			sent = append(sent, string(bytes))
+			return nil
+		},
+	}
+
+	factory := &mock.FakeWebsocketClientFactory{
+		FakeClient: func() (domain.WebsocketClient, error) {
+			return client, nil
+		},
+	}
+
+	errWriter := &bytes.Buffer{}
+	cmd := NotifyCommand{
+		WebsocketClientFactory: factory,
+		MessageFactory:         msgFactory,
+		Stream:                 true,
+		ErrorWriter:            errWriter,
+	}
+
+	if err := cmd.Run(); err == nil {
+		t.Fatal("should be error")
+	}
+
+	if want := []string{"1", "3"}; !reflect.DeepEqual(sent, want) {
+		t.Errorf("want %v, but %v:", want, sent)
+	}
+	if got, want := errWriter.String(), "line 2: invalid\n"; got != want {
+		t.Errorf("want %v, but %v:", want, got)
+	}
+}
@@ -2,7 +2,9 @@ package command
 
 import (
 	"io"
+	"time"
 
+	"github.com/notomo/wsxhub/internal"
 	"github.com/notomo/wsxhub/internal/domain"
 )
 
@@ -10,10 +12,13 @@ import (
 type ReceiveCommand struct {
 	WebsocketClientFactory domain.WebsocketClientFactory
 	OutputWriter           io.Writer
-	Timeout                int
+	Timeout                time.Duration
+	IdleTimeout            time.Duration
 }
 
 // Run : outputs the received messages
+// Timeout is for the first message, and IdleTimeout (Timeout if 0) is for each next message.
+// Passing IdleTimeout after the last message ends without error.
 func (cmd *ReceiveCommand) Run() error {
 	client, err := cmd.WebsocketClientFactory.Client()
 	if err != nil {
@@ -21,12 +26,35 @@ func (cmd *ReceiveCommand) Run() error {
 	}
 	defer client.Close()
 
-	if err := client.Receive(cmd.Timeout, func(message []byte) error {
-		_, err := cmd.OutputWriter.Write(append(message, '\n'))
-		return err
-	}); err != nil {
-		return err
+	timeout := cmd.Timeout
+	for received := 0; ; received++ {
+		message, err := client.ReceiveOnce(timeout)
+		if err == internal.ErrEOF {
+			return nil
+		}
+		if err == internal.ErrTimeout && received > 0 && cmd.IdleTimeout > 0 {
+			return nil
+		}
+		if err != nil {
+			return phaseTimeout(err, received)
+		}
+		if cmd.IdleTimeout > 0 {
+			timeout = cmd.IdleTimeout
+		}
+
+		if _, err := cmd.OutputWriter.Write(append(message, '\n')); err != nil {
+			return err
+		}
 	}
+}
 
-	return nil
+// phaseTimeout : distinguishes the timeout before the first message from the timeout between the messages
+func phaseTimeout(err error, received int) error {
+	if err != internal.ErrTimeout {
+		return err
+	}
+	if received == 0 {
+		return internal.ErrReplyTimeout
+	}
+	return internal.ErrIdleTimeout
 }
@@ -3,41 +3,95 @@ package command
 import (
 	"bytes"
 	"testing"
+	"time"
 
+	"github.com/notomo/wsxhub/internal"
 	"github.com/notomo/wsxhub/internal/domain"
 	"github.com/notomo/wsxhub/internal/mock"
 )
 
 func TestReceiveRun(t *testing.T) {
-	message := "received"
-	client := &mock.FakeWebsocketClient{
-		FakeClose: func() error {
-			return nil
+	tests := []struct {
+		name        string
+		idleTimeout time.Duration
+		results     []error
+		want        string
+		wantErr     error
+	}{
+		{
+			name:    "ends by eof",
+			results: []error{nil, nil, internal.ErrEOF},
+			want:    "received\nreceived\n",
 		},
-		FakeReceive: func(timeout int, callback func([]byte) error) error {
-			return callback([]byte(message))
+		{
+			name:    "reply timeout",
+			results: []error{internal.ErrTimeout},
+			want:    "",
+			wantErr: internal.ErrReplyTimeout,
 		},
-	}
-
-	factory := &mock.FakeWebsocketClientFactory{
-		FakeClient: func() (domain.WebsocketClient, error) {
-			return client, nil
+		{
+			name:    "idle timeout without idle timeout option",
+			results: []error{nil, internal.ErrTimeout},
+			want:    "received\n",
+			wantErr: internal.ErrIdleTimeout,
+		},
+		{
+			name:        "idle timeout with idle timeout option",
+			idleTimeout: 100 * time.Millisecond,
+			results:     []error{nil, internal.ErrTimeout},
+			want:        "received\n",
 		},
 	}
 
-	writer := &bytes.Buffer{}
-	cmd := ReceiveCommand{
-		WebsocketClientFactory: factory,
-		OutputWriter:           writer,
-	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			timeout := 2 * time.Second
+			timeouts := []time.Duration{}
+			results := test.results
+			client := &mock.FakeWebsocketClient{
+				FakeClose: func() error {
+					return nil
+				},
+				FakeReceiveOnce: func(timeout time.Duration) ([]byte, error) {
+					timeouts = append(timeouts, timeout)
+					err := results[0]
+					results = results[1:]
+					if err != nil {
+						return nil, err
+					}
+					return []byte("received"), nil
+				},
+			}
 
-	if err := cmd.Run(); err != nil {
-		t.Fatalf("should not be error: %v", err)
-	}
+			factory := &mock.FakeWebsocketClientFactory{
+				FakeClient: func() (domain.WebsocketClient, error) {
+					return client, nil
+				},
+			}
+
+			writer := &bytes.Buffer{}
+			cmd := ReceiveCommand{
+				WebsocketClientFactory: factory,
+				OutputWriter:           writer,
+				Timeout:                timeout,
+				IdleTimeout:            test.idleTimeout,
+			}
+
+			if err := cmd.Run(); err != test.wantErr {
+				t.Fatalf("want error %v, but %v:", test.wantErr, err)
+			}
+
+			if got := writer.String(); got != test.want {
+				t.Errorf("want %v, but %v:", test.want, got)
+			}
 
-	got := writer.String()
-	want := message + "\n"
-	if got != want {
-		t.Errorf("want %v, but %v:", want, got)
+			if timeouts[0] != timeout {
+				t.Errorf("want first timeout %v, but %v:", timeout, timeouts[0])
+			}
+			if test.idleTimeout > 0 && len(timeouts) > 1 && timeouts[1] != test.idleTimeout {
+				t.Errorf("want idle timeout %v, but %v:", test.idleTimeout, timeouts[1])
+			}
+		})
 	}
 }
@@ -1,7 +1,10 @@
 package command
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"time"
 
 	"github.com/notomo/wsxhub/internal"
 	"github.com/notomo/wsxhub/internal/domain"
@@ -12,11 +15,22 @@ type SendCommand struct {
 	WebsocketClientFactory domain.WebsocketClientFactory
 	OutputWriter           io.Writer
 	MessageFactory         domain.MessageFactory
-	Timeout                int
+	Timeout                time.Duration
 	InputReader            io.Reader
+	Stream                 bool
+	ErrorWriter            io.Writer
+	Count                  int
+	UntilFilterClause      domain.FilterClause
+	IdleTimeout            time.Duration
 }
 
 // Run : sends a message to wsxhub server and receives the response
+// Timeout is for the first response, and IdleTimeout (Timeout if 0) is for each next response.
+// With Count over 1, negative Count (no limit) or UntilFilterClause, outputs the responses line by line
+// until Count responses are received, a response matches UntilFilterClause, or IdleTimeout passes after the last response.
+// In the stream mode, sends each json value in the input as it arrives
+// and outputs the responses line by line until all the messages are responded.
+// Timeout runs only while some messages wait for the responses, so the input can pause longer.
 func (cmd *SendCommand) Run() error {
 	client, err := cmd.WebsocketClientFactory.Client()
 	if err != nil {
@@ -24,18 +38,32 @@ func (cmd *SendCommand) Run() error {
 	}
 	defer client.Close()
 
+	if cmd.Stream {
+		if cmd.MultipleReplies() {
+			return &internal.InputError{Err: errors.New("count and until can't be used with stream")}
+		}
+		return cmd.stream(client)
+	}
+
 	message, err := cmd.MessageFactory.FromReader(cmd.InputReader)
 	if err != nil {
-		return err
+		return &internal.InputError{Err: err}
 	}
 
 	if err := client.Send(message.Bytes()); err != nil {
 		return err
 	}
 
+	if cmd.MultipleReplies() {
+		return cmd.receiveReplies(client)
+	}
+
 	received, err := client.ReceiveOnce(cmd.Timeout)
-	if err != nil && err != internal.ErrEOF {
-		return err
+	if err == internal.ErrEOF {
+		return internal.ErrRemoteClosed
+	}
+	if err != nil {
+		return phaseTimeout(err, 0)
 	}
 
 	if _, err := cmd.OutputWriter.Write(received); err != nil {
@@ -44,3 +72,150 @@ func (cmd *SendCommand) Run() error {
 
 	return nil
 }
+
+// MultipleReplies : returns true if the command waits for more than one reply to the message
+func (cmd *SendCommand) MultipleReplies() bool {
+	return cmd.Count > 1 || cmd.Count < 0 || cmd.UntilFilterClause != nil
+}
+
+func (cmd *SendCommand) receiveReplies(client domain.WebsocketClient) error {
+	timeout := cmd.Timeout
+	for received := 0; cmd.Count <= 0 || received < cmd.Count; received++ {
+		reply, err := client.ReceiveOnce(timeout)
+		if err == internal.ErrEOF {
+			return cmd.closedError(received)
+		}
+		if err == internal.ErrTimeout && received > 0 && cmd.IdleTimeout > 0 {
+			return nil
+		}
+		if err != nil {
+			return phaseTimeout(err, received)
+		}
+		if cmd.IdleTimeout > 0 {
+			timeout = cmd.IdleTimeout
+		}
+
+		if _, err := cmd.OutputWriter.Write(append(reply, '\n')); err != nil {
+			return err
+		}
+
+		if cmd.UntilFilterClause == nil {
+			continue
+		}
+		message, err := cmd.MessageFactory.FromBytes(reply)
+		if err != nil {
+			return err
+		}
+		matched, err := cmd.UntilFilterClause.Match(message)
+		if err != nil {
+			return err
+		}
+		if matched {
+			return nil
+		}
+	}
+	return nil
+}
+
+// closedError : the server closing before the expected replies is an error
+func (cmd *SendCommand) closedError(received int) error {
+	if received == 0 || cmd.Count > 0 || cmd.UntilFilterClause != nil {
+		return internal.ErrRemoteClosed
+	}
+	return nil
+}
+
+type streamResult struct {
+	sent    int
+	invalid int
+	err     error
+}
+
+func (cmd *SendCommand) stream(client domain.WebsocketClient) error {
+	done := make(chan bool)
+	defer close(done)
+
+	sending := make(chan streamResult, 1)
+	sentOne := make(chan bool)
+	go func() {
+		result := streamResult{}
+		result.err = cmd.MessageFactory.FromStream(cmd.InputReader, func(message domain.Message, err error) error {
+			if err != nil {
+				result.invalid++
+				_, err := fmt.Fprintln(cmd.ErrorWriter, err)
+				return err
+			}
+			if err := client.Send(message.Bytes()); err != nil {
+				return err
+			}
+			result.sent++
+			select {
+			case sentOne <- true:
+			case <-done:
+			}
+			return nil
+		})
+		sending <- result
+	}()
+
+	replies := make(chan []byte)
+	receiving := make(chan error, 1)
+	go func() {
+		// the input can pause longer than the timeout, so the timeout is only for the pending replies
+		receiving <- client.Receive(0, func(reply []byte) error {
+			select {
+			case replies <- reply:
+			case <-done:
+			}
+			return nil
+		})
+	}()
+
+	var timer *time.Timer
+	var timeout <-chan time.Time
+	wait := func(pending bool) {
+		if timer != nil {
+			timer.Stop()
+		}
+		timeout = nil
+		if pending && cmd.Timeout > 0 {
+			timer = time.NewTimer(cmd.Timeout)
+			timeout = timer.C
+		}
+	}
+	defer wait(false)
+
+	var result *streamResult
+	sent := 0
+	received := 0
+	for result == nil || received < result.sent {
+		select {
+		case r := <-sending:
+			if r.err != nil {
+				return r.err
+			}
+			result = &r
+		case <-sentOne:
+			sent++
+			// the reply can arrive before the notification
+			if timeout == nil {
+				wait(received < sent)
+			}
+		case reply := <-replies:
+			received++
+			wait(received < sent)
+			if _, err := cmd.OutputWriter.Write(append(reply, '\n')); err != nil {
+				return err
+			}
+		case <-timeout:
+			return phaseTimeout(internal.ErrTimeout, received)
+		case err := <-receiving:
+			if err != nil {
+				return phaseTimeout(err, received)
+			}
+			return internal.ErrRemoteClosed
+		}
+	}
+
+	return invalidMessagesError(result.invalid)
+}
@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"io"
 	"testing"
+	"time"
 
+	"github.com/notomo/wsxhub/internal"
 	"github.com/notomo/wsxhub/internal/domain"
 	"github.com/notomo/wsxhub/internal/mock"
 )
@@ -31,7 +33,7 @@ func TestSendRun(t *testing.T) {
 		FakeSend: func(bytes []byte) error {
 			return nil
 		},
-		FakeReceiveOnce: func(timeout int) ([]byte, error) {
+		FakeReceiveOnce: func(timeout time.Duration) ([]byte, error) {
 			return []byte(want), nil
 		},
 	}
@@ -58,3 +60,334 @@ func TestSendRun(t *testing.T) {
 		t.Errorf("want %v, but %v:", want, got)
 	}
 }
+
+func TestSendRunRemoteClosed(t *testing.T) {
+	msgFactory := &mock.FakeMessageFactory{
+		FakeFromReader: func(inputReader io.Reader) (domain.Message, error) {
+			return &mock.FakeMessage{
+				FakeBytes: func() []byte {
+					return []byte("send")
+				},
+			}, nil
+		},
+	}
+
+	client := &mock.FakeWebsocketClient{
+		FakeClose: func() error {
+			return nil
+		},
+		FakeSend: func(bytes []byte) error {
+			return nil
+		},
+		FakeReceiveOnce: func(timeout time.Duration) ([]byte, error) {
+			return nil, internal.ErrEOF
+		},
+	}
+
+	factory := &mock.FakeWebsocketClientFactory{
+		FakeClient: func() (domain.WebsocketClient, error) {
+			return client, nil
+		},
+	}
+
+	writer := &bytes.Buffer{}
+	cmd := SendCommand{
+		WebsocketClientFactory: factory,
+		MessageFactory:         msgFactory,
+		OutputWriter:           writer,
+	}
+
+	if err := cmd.Run(); err != internal.ErrRemoteClosed {
+		t.Fatalf("want %v, but %v:", internal.ErrRemoteClosed, err)
+	}
+	if got := writer.String(); got != "" {
+		t.Errorf("should not output, but %v:", got)
+	}
+}
+
+func TestSendRunStream(t *testing.T) {
+	newMessage := func(s string) domain.Message {
+		return &mock.FakeMessage{
+			FakeBytes: func() []byte {
+				return []byte(s)
+			},
+		}
+	}
+
+	msgFactory := &mock.FakeMessageFactory{
+		FakeFromStream: func(inputReader io.Reader, callback func(domain.Message, error) error) error {
+			if err := callback(newMessage("1"), nil); err != nil {
+				return err
+			}
+			return callback(newMessage("2"), nil)
+		},
+	}
+
+	sent := make(chan []byte, 2)
+	client := &mock.FakeWebsocketClient{
+		FakeClose: func() error {
+			return nil
+		},
+		FakeSend: func(bytes []byte) error {
+			sent <- bytes
+			return nil
+		},
+		FakeReceive: func(timeout time.Duration, callback func([]byte) error) error {
+			for i := 0; i < 2; i++ {
+				if err := callback(append([]byte("reply"), <-sent...)); err != nil {
+					return err
+				}
+			}
+			select {}
+		},
+	}
+
+	factory := &mock.FakeWebsocketClientFactory{
+		FakeClient: func() (domain.WebsocketClient, error) {
+			return client, nil
+		},
+	}
+
+	writer := &bytes.Buffer{}
+	cmd := SendCommand{
+		WebsocketClientFactory: factory,
+		MessageFactory:         msgFactory,
+		OutputWriter:           writer,
+		Stream:                 true,
+	}
+
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("should not be error: %v", err)
+	}
+
+	if got, want := writer.String(), "reply1\nreply2\n"; got != want {
+		t.Errorf("want %v, but %v:", want, got)
+	}
+}
+
+func TestSendRunStreamTimeout(t *testing.T) {
+	newMessage := func(s string) domain.Message {
+		return &mock.FakeMessage{
+			FakeBytes: func() []byte {
+				return []byte(s)
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		replies int
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "input delayed longer than the timeout",
+			replies: 2,
+			want:    "reply1\nreply2\n",
+		},
+		{
+			name:    "reply missing",
+			replies: 1,
+			want:    "reply1\n",
+			wantErr: internal.ErrIdleTimeout,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			timeout := 20 * time.Millisecond
+			msgFactory := &mock.FakeMessageFactory{
+				FakeFromStream: func(inputReader io.Reader, callback func(domain.Message, error) error) error {
+					if err := callback(newMessage("1"), nil); err != nil {
+						return err
+					}
+					time.Sleep(3 * timeout)
+					return callback(newMessage("2"), nil)
+				},
+			}
+
+			sent := make(chan []byte, 2)
+			client := &mock.FakeWebsocketClient{
+				FakeClose: func() error {
+					return nil
+				},
+				FakeSend: func(bytes []byte) error {
+					sent <- bytes
+					return nil
+				},
+				FakeReceive: func(readTimeout time.Duration, callback func([]byte) error) error {
+					for i := 0; ; i++ {
+						// the read deadline like the real client
+						var deadline <-chan time.Time
+						if readTimeout > 0 {
+							deadline = time.After(readTimeout)
+						}
+						replied := sent
+						if i >= test.replies {
+							replied = nil
+						}
+						select {
+						case bytes := <-replied:
+							if err := callback(append([]byte("reply"), bytes...)); err != nil {
+								return err
+							}
+						case <-deadline:
+							return internal.ErrTimeout
+						}
+					}
+				},
+			}
+
+			factory := &mock.FakeWebsocketClientFactory{
+				FakeClient: func() (domain.WebsocketClient, error) {
+					return client, nil
+				},
+			}
+
+			writer := &bytes.Buffer{}
+			cmd := SendCommand{
+				WebsocketClientFactory: factory,
+				MessageFactory:         msgFactory,
+				OutputWriter:           writer,
+				Stream:                 true,
+				Timeout:                timeout,
+			}
+
+			if err := cmd.Run(); err != test.wantErr {
+				t.Fatalf("want error %v, but %v:", test.wantErr, err)
+			}
+
+			if got := writer.String(); got != test.want {
+				t.Errorf("want %v, but %v:", test.want, got)
+			}
+		})
+	}
+}
+
+func TestSendRunReplies(t *testing.T) {
+	msg := &mock.FakeMessage{
+		FakeBytes: func() []byte {
+			return []byte("send")
+		},
+	}
+
+	tests := []struct {
+		name        string
+		count       int
+		until       string
+		idleTimeout time.Duration
+		closed      bool
+		want        string
+		wantErr     error
+	}{
+		{
+			name:  "count",
+			count: 2,
+			want:  "progress1\nprogress2\n",
+		},
+		{
+			name:  "until",
+			until: "result",
+			want:  "progress1\nprogress2\nresult\n",
+		},
+		{
+			name:        "idle timeout",
+			count:       -1,
+			idleTimeout: time.Second,
+			want:        "progress1\nprogress2\nresult\n",
+		},
+		{
+			name:    "closed before count",
+			count:   5,
+			closed:  true,
+			want:    "progress1\nprogress2\nresult\n",
+			wantErr: internal.ErrRemoteClosed,
+		},
+		{
+			name:    "closed before until matched",
+			until:   "done",
+			closed:  true,
+			want:    "progress1\nprogress2\nresult\n",
+			wantErr: internal.ErrRemoteClosed,
+		},
+		{
+			name:   "closed without limit",
+			count:  -1,
+			closed: true,
+			want:   "progress1\nprogress2\nresult\n",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			replies := []string{"progress1", "progress2", "result"}
+			client := &mock.FakeWebsocketClient{
+				FakeClose: func() error {
+					return nil
+				},
+				FakeSend: func(bytes []byte) error {
+					return nil
+				},
+				FakeReceiveOnce: func(timeout time.Duration) ([]byte, error) {
+					if len(replies) == 0 && test.closed {
+						return nil, internal.ErrEOF
+					}
+					if len(replies) == 0 {
+						if timeout != test.idleTimeout {
+							t.Errorf("want %v, but %v:", test.idleTimeout, timeout)
+						}
+						return nil, internal.ErrTimeout
+					}
+					reply := replies[0]
+					replies = replies[1:]
+					return []byte(reply), nil
+				},
+			}
+
+			factory := &mock.FakeWebsocketClientFactory{
+				FakeClient: func() (domain.WebsocketClient, error) {
+					return client, nil
+				},
+			}
+
+			msgFactory := &mock.FakeMessageFactory{
+				FakeFromReader: func(inputReader io.Reader) (domain.Message, error) {
+					return msg, nil
+				},
+				FakeFromBytes: func(b []byte) (domain.Message, error) {
+					return &mock.FakeMessage{
+						FakeBytes: func() []byte {
+							return b
+						},
+					}, nil
+				},
+			}
+
+			writer := &bytes.Buffer{}
+			cmd := SendCommand{
+				WebsocketClientFactory: factory,
+				MessageFactory:         msgFactory,
+				OutputWriter:           writer,
+				Count:                  test.count,
+				IdleTimeout:            test.idleTimeout,
+			}
+			if test.until != "" {
+				cmd.UntilFilterClause = &mock.FakeFilterClause{
+					FakeMatch: func(message domain.Message) (bool, error) {
+						return string(message.Bytes()) == test.until, nil
+					},
+				}
+			}
+
+			if err := cmd.Run(); err != test.wantErr {
+				t.Fatalf("want error %v, but %v:", test.wantErr, err)
+			}
+
+			if got := writer.String(); got != test.want {
+				t.Errorf("want %v, but %v:", test.want, got)
+			}
+		})
+	}
+}
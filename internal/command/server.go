@@ -1,6 +1,8 @@
 package command
 
 import (
+	"os"
+
 	"github.com/notomo/wsxhub/internal/domain"
 )
 
@@ -8,37 +10,97 @@ import (
 type ServerCommand struct {
 	OutsideServerFactory domain.ServerFactory
 	InsideServerFactory  domain.ServerFactory
+	AdminServerFactory   domain.AdminServerFactory
+	Signals              <-chan os.Signal
+	ConfigReloader       domain.ConfigReloader
+	Reloads              <-chan string
+	Logger               domain.Logger
 }
 
 // Run : starts a wsxhub server
 // Inside server responds to wsxhub clients.
 // Outside server responds to the other clients.
+// Inside and outside connections exchange messages on the default channel `/` or the named channels `/ch/{name}`.
+// The servers are shut down gracefully by the signals or an error of the other server.
+// The config is reloaded on each reload request without dropping the connections.
+// Admin server serves the introspection API if given.
 func (cmd *ServerCommand) Run() error {
-	outsideServer, err := cmd.OutsideServerFactory.Server(
-		domain.NewRoute(
-			"/",
-			func(conn domain.Connection) error {
-				return conn.Listen()
-			},
-		),
-	)
+	listen := func(conn domain.Connection) error {
+		return conn.Listen()
+	}
+	routes := []domain.Route{
+		domain.NewRoute("/", listen),
+		domain.NewRoute(domain.ChannelPathPrefix, listen),
+	}
+
+	outsideServer, err := cmd.OutsideServerFactory.Server(routes...)
 	if err != nil {
 		return err
 	}
 
-	insideServer, err := cmd.InsideServerFactory.Server(
-		domain.NewRoute(
-			"/",
-			func(conn domain.Connection) error {
-				return conn.Listen()
-			},
-		),
-	)
+	insideServer, err := cmd.InsideServerFactory.Server(routes...)
 	if err != nil {
 		return err
 	}
 
-	go insideServer.Start()
+	servers := []domain.Server{insideServer, outsideServer}
+	if cmd.AdminServerFactory != nil {
+		adminServer, err := cmd.AdminServerFactory.Server()
+		if err != nil {
+			return err
+		}
+		// shut down first not to inspect the finished workers
+		servers = append([]domain.Server{adminServer}, servers...)
+	}
+	stopped := make(chan error, len(servers))
+	for _, server := range servers {
+		server := server
+		go func() {
+			stopped <- server.Start()
+		}()
+	}
+
+	running := len(servers)
+	err = cmd.wait(stopped, &running)
 
-	return outsideServer.Start()
+	for _, server := range servers {
+		if shutdownErr := server.Shutdown(); shutdownErr != nil && err == nil {
+			err = shutdownErr
+		}
+	}
+
+	// Start returns after the worker sent the close frames and drained the send results
+	for ; running > 0; running-- {
+		select {
+		case stoppedErr := <-stopped:
+			if stoppedErr != nil && err == nil {
+				err = stoppedErr
+			}
+		case sig := <-cmd.Signals:
+			// does not wait for the stuck shutdown by the second signal
+			cmd.Logger.Warn("stopped without waiting for the shutdown", "signal", sig)
+			return err
+		}
+	}
+
+	return err
+}
+
+// wait : reloads the config on each request until a server stops or the signal is received
+func (cmd *ServerCommand) wait(stopped <-chan error, running *int) error {
+	for {
+		select {
+		case err := <-stopped:
+			*running--
+			return err
+		case sig := <-cmd.Signals:
+			cmd.Logger.Info("received signal", "signal", sig)
+			return nil
+		case reason := <-cmd.Reloads:
+			cmd.Logger.Info("reloading config", "reason", reason)
+			if err := cmd.ConfigReloader.Reload(); err != nil {
+				cmd.Logger.Error("rejected config", "error", err)
+			}
+		}
+	}
 }
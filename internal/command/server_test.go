@@ -0,0 +1,219 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/notomo/wsxhub/internal/domain"
+	"github.com/notomo/wsxhub/internal/mock"
+)
+
+func TestServerRun(t *testing.T) {
+	newServer := func(startErr error, shutdown chan bool) *mock.FakeServer {
+		stopped := make(chan bool)
+		return &mock.FakeServer{
+			FakeStart: func() error {
+				if startErr != nil {
+					return startErr
+				}
+				<-stopped
+				return nil
+			},
+			FakeShutdown: func() error {
+				if startErr == nil {
+					close(stopped)
+				}
+				shutdown <- true
+				return nil
+			},
+		}
+	}
+	newFactory := func(server domain.Server) domain.ServerFactory {
+		return &mock.FakeServerFactory{
+			FakeServer: func(routes ...domain.Route) (domain.Server, error) {
+				return server, nil
+			},
+		}
+	}
+
+	newLogger := func(logged *[]string) domain.Logger {
+		return &mock.FakeLogger{
+			FakeLog: func(level string, msg string, keyValues ...interface{}) {
+				*logged = append(*logged, level+": "+msg)
+			},
+		}
+	}
+
+	t.Run("signal", func(t *testing.T) {
+		shutdown := make(chan bool, 2)
+		signals := make(chan os.Signal, 1)
+		cmd := ServerCommand{
+			OutsideServerFactory: newFactory(newServer(nil, shutdown)),
+			InsideServerFactory:  newFactory(newServer(nil, shutdown)),
+			Signals:              signals,
+			Logger:               newLogger(&[]string{}),
+		}
+
+		signals <- syscall.SIGTERM
+		if err := cmd.Run(); err != nil {
+			t.Fatalf("should not be error: %v", err)
+		}
+
+		if got, want := len(shutdown), 2; got != want {
+			t.Errorf("want %v, but %v:", want, got)
+		}
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		shutdown := make(chan bool, 2)
+		signals := make(chan os.Signal, 1)
+		reloads := make(chan string)
+		reloaded := 0
+		logged := []string{}
+		cmd := ServerCommand{
+			OutsideServerFactory: newFactory(newServer(nil, shutdown)),
+			InsideServerFactory:  newFactory(newServer(nil, shutdown)),
+			Signals:              signals,
+			ConfigReloader: &mock.FakeConfigReloader{
+				FakeReload: func() error {
+					reloaded++
+					if reloaded == 2 {
+						return fmt.Errorf("invalid config")
+					}
+					return nil
+				},
+			},
+			Reloads: reloads,
+			Logger:  newLogger(&logged),
+		}
+
+		go func() {
+			reloads <- "SIGHUP"
+			reloads <- "SIGHUP"
+			reloads <- "SIGHUP"
+			signals <- syscall.SIGTERM
+		}()
+		if err := cmd.Run(); err != nil {
+			t.Fatalf("should not be error: %v", err)
+		}
+
+		if want := 3; reloaded != want {
+			t.Errorf("want %v, but %v:", want, reloaded)
+		}
+		if got, want := logged[len(logged)-3], "error: rejected config"; got != want {
+			t.Errorf("want %v, but %v:", want, got)
+		}
+		if got, want := len(shutdown), 2; got != want {
+			t.Errorf("want %v, but %v:", want, got)
+		}
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		shutdown := make(chan bool, 3)
+		signals := make(chan os.Signal, 1)
+		adminServer := newServer(nil, shutdown)
+		cmd := ServerCommand{
+			OutsideServerFactory: newFactory(newServer(nil, shutdown)),
+			InsideServerFactory:  newFactory(newServer(nil, shutdown)),
+			AdminServerFactory: &mock.FakeAdminServerFactory{
+				FakeServer: func() (domain.Server, error) {
+					return adminServer, nil
+				},
+			},
+			Signals: signals,
+			Logger:  newLogger(&[]string{}),
+		}
+
+		signals <- syscall.SIGTERM
+		if err := cmd.Run(); err != nil {
+			t.Fatalf("should not be error: %v", err)
+		}
+
+		if got, want := len(shutdown), 3; got != want {
+			t.Errorf("want %v, but %v:", want, got)
+		}
+	})
+
+	t.Run("wait for the servers to finish", func(t *testing.T) {
+		finished := make(chan bool, 2)
+		newFinishingServer := func() *mock.FakeServer {
+			stopped := make(chan bool)
+			return &mock.FakeServer{
+				FakeStart: func() error {
+					<-stopped
+					time.Sleep(10 * time.Millisecond)
+					finished <- true
+					return nil
+				},
+				FakeShutdown: func() error {
+					close(stopped)
+					return nil
+				},
+			}
+		}
+		signals := make(chan os.Signal, 1)
+		cmd := ServerCommand{
+			OutsideServerFactory: newFactory(newFinishingServer()),
+			InsideServerFactory:  newFactory(newFinishingServer()),
+			Signals:              signals,
+			Logger:               newLogger(&[]string{}),
+		}
+
+		signals <- syscall.SIGTERM
+		if err := cmd.Run(); err != nil {
+			t.Fatalf("should not be error: %v", err)
+		}
+
+		if got, want := len(finished), 2; got != want {
+			t.Errorf("want %v, but %v:", want, got)
+		}
+	})
+
+	t.Run("stop by the second signal without waiting", func(t *testing.T) {
+		stuck := &mock.FakeServer{
+			FakeStart: func() error {
+				select {}
+			},
+			FakeShutdown: func() error {
+				return nil
+			},
+		}
+		signals := make(chan os.Signal, 2)
+		logged := []string{}
+		cmd := ServerCommand{
+			OutsideServerFactory: newFactory(stuck),
+			InsideServerFactory:  newFactory(stuck),
+			Signals:              signals,
+			Logger:               newLogger(&logged),
+		}
+
+		signals <- syscall.SIGTERM
+		signals <- syscall.SIGTERM
+		if err := cmd.Run(); err != nil {
+			t.Fatalf("should not be error: %v", err)
+		}
+
+		if got, want := logged[len(logged)-1], "warn: stopped without waiting for the shutdown"; got != want {
+			t.Errorf("want %v, but %v:", want, got)
+		}
+	})
+
+	t.Run("fail to start", func(t *testing.T) {
+		shutdown := make(chan bool, 2)
+		cmd := ServerCommand{
+			OutsideServerFactory: newFactory(newServer(fmt.Errorf("address already in use"), shutdown)),
+			InsideServerFactory:  newFactory(newServer(nil, shutdown)),
+		}
+
+		if err := cmd.Run(); err == nil {
+			t.Fatalf("should be error")
+		}
+
+		if got, want := len(shutdown), 2; got != want {
+			t.Errorf("want %v, but %v:", want, got)
+		}
+	})
+}
@@ -0,0 +1,44 @@
+package domain
+
+import "encoding/json"
+
+// ConfigFactory :
+type ConfigFactory interface {
+	Config(path string) (*Config, error)
+}
+
+// ConfigReloader : applies the reloaded config to the running servers
+type ConfigReloader interface {
+	Reload() error
+}
+
+// Config : settings of `wsxhub server`
+type Config struct {
+	Inside          ListenerConfig `json:"inside"`
+	Outside         ListenerConfig `json:"outside"`
+	Admin           AdminConfig    `json:"admin"`
+	CorrelationKey  string         `json:"correlationKey"`
+	RetainKey       string         `json:"retainKey"`
+	SendQueueSize   int            `json:"sendQueueSize"`
+	SendQueuePolicy OverflowPolicy `json:"sendQueuePolicy"`
+	MaxMessageSize  int64          `json:"maxMessageSize"`
+	MaxMessageDepth int            `json:"maxMessageDepth"`
+	MaxBatchLength  int            `json:"maxBatchLength"`
+}
+
+// ListenerConfig : settings of the inside or outside server
+type ListenerConfig struct {
+	Listen        []string        `json:"listen"`
+	Allow         string          `json:"allow"`
+	AllowOrigins  []string        `json:"allowOrigins"`
+	TokenFile     string          `json:"tokenFile"`
+	TLSCert       string          `json:"tlsCert"`
+	TLSKey        string          `json:"tlsKey"`
+	DefaultFilter json.RawMessage `json:"defaultFilter"`
+}
+
+// AdminConfig : settings of the admin server (disabled if no listen address)
+type AdminConfig struct {
+	Listen    []string `json:"listen"`
+	TokenFile string   `json:"tokenFile"`
+}
@@ -1,9 +1,69 @@
 package domain
 
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
 // Connection :
 type Connection interface {
 	ID() string
+	Channel() string
+	RemoteAddress() string
 	Listen() error
 	Send(Message) (bool, error)
 	Close() error
+	Shutdown() error
+	Correlated() bool
+	ReceivesRetained() bool
+	Dropped() int
+	Info() ConnectionInfo
+}
+
+// ConnectionInfo : snapshot of a connection for introspection
+type ConnectionInfo struct {
+	Side          string          `json:"side"`
+	ID            string          `json:"id"`
+	Channel       string          `json:"channel"`
+	RemoteAddress string          `json:"remoteAddress"`
+	Filter        json.RawMessage `json:"filter"`
+	Debounce      int             `json:"debounce"`
+	ConnectedAt   time.Time       `json:"connectedAt"`
+	Sent          int             `json:"sent"`
+	Dropped       int             `json:"dropped"`
+}
+
+// OverflowPolicy :
+type OverflowPolicy string
+
+var (
+	// OverflowPolicyDropOldest :
+	OverflowPolicyDropOldest = OverflowPolicy("dropOldest")
+	// OverflowPolicyDropNewest :
+	OverflowPolicyDropNewest = OverflowPolicy("dropNewest")
+	// OverflowPolicyDisconnect :
+	OverflowPolicyDisconnect = OverflowPolicy("disconnect")
+	// OverflowPolicyDefault :
+	OverflowPolicyDefault = OverflowPolicy("")
+)
+
+// Validate :
+func (policy OverflowPolicy) Validate() error {
+	value := string(policy)
+	for _, typ := range overflowPolicies() {
+		if value == string(typ) {
+			return nil
+		}
+	}
+	return errors.New("invalid OverflowPolicy: " + value)
+}
+
+func overflowPolicies() []OverflowPolicy {
+	return []OverflowPolicy{
+		OverflowPolicyDropOldest,
+		OverflowPolicyDropNewest,
+		OverflowPolicyDisconnect,
+		OverflowPolicyDefault,
+	}
 }
@@ -51,6 +51,18 @@ var (
 	MatchTypeContainedKey = MatchType("containedKey")
 	// MatchTypeContainKey :
 	MatchTypeContainKey = MatchType("containKey")
+	// MatchTypeGreaterThan :
+	MatchTypeGreaterThan = MatchType("gt")
+	// MatchTypeGreaterThanOrEqual :
+	MatchTypeGreaterThanOrEqual = MatchType("gte")
+	// MatchTypeLessThan :
+	MatchTypeLessThan = MatchType("lt")
+	// MatchTypeLessThanOrEqual :
+	MatchTypeLessThanOrEqual = MatchType("lte")
+	// MatchTypeBetween :
+	MatchTypeBetween = MatchType("between")
+	// MatchTypeIn :
+	MatchTypeIn = MatchType("in")
 	// MatchTypeDefault :
 	MatchTypeDefault = MatchType("")
 )
@@ -75,10 +87,25 @@ func matchTypes() []MatchType {
 		MatchTypeContain,
 		MatchTypeContainedKey,
 		MatchTypeContainKey,
+		MatchTypeGreaterThan,
+		MatchTypeGreaterThanOrEqual,
+		MatchTypeLessThan,
+		MatchTypeLessThanOrEqual,
+		MatchTypeBetween,
+		MatchTypeIn,
 		MatchTypeDefault,
 	}
 }
 
+// IsComparison : returns true if the match type compares the values
+func (matchType MatchType) IsComparison() bool {
+	switch matchType {
+	case MatchTypeGreaterThan, MatchTypeGreaterThanOrEqual, MatchTypeLessThan, MatchTypeLessThanOrEqual, MatchTypeBetween, MatchTypeIn:
+		return true
+	}
+	return false
+}
+
 // FilterClauseFactory :
 type FilterClauseFactory interface {
 	FilterClause(string) (FilterClause, error)
@@ -0,0 +1,10 @@
+package domain
+
+// Logger : writes leveled logs with the fields given as key value pairs
+type Logger interface {
+	Debug(msg string, keyValues ...interface{})
+	Info(msg string, keyValues ...interface{})
+	Warn(msg string, keyValues ...interface{})
+	Error(msg string, keyValues ...interface{})
+	With(keyValues ...interface{}) Logger
+}
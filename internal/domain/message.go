@@ -6,10 +6,14 @@ import "io"
 type MessageFactory interface {
 	FromReader(io.Reader) (Message, error)
 	FromBytes([]byte) (Message, error)
+	FromStream(io.Reader, func(Message, error) error) error
 }
 
 // Message :
 type Message interface {
 	Bytes() []byte
 	Unmarshaled() []map[string]interface{}
+	Batch() bool
+	ReplaceField(string, func(interface{}, bool) (interface{}, bool)) (Message, error)
+	Subset([]int) (Message, error)
 }
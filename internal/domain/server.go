@@ -5,11 +5,20 @@ type ServerFactory interface {
 	Server(...Route) (Server, error)
 }
 
+// AdminServerFactory :
+type AdminServerFactory interface {
+	Server() (Server, error)
+}
+
 // Server :
 type Server interface {
 	Start() error
+	Shutdown() error
 }
 
+// ChannelPathPrefix : the path prefix of the routes for the named channels like `/ch/neovim`
+const ChannelPathPrefix = "/ch/"
+
 // Route :
 type Route struct {
 	Path    string
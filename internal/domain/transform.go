@@ -0,0 +1,11 @@
+package domain
+
+// TransformerFactory :
+type TransformerFactory interface {
+	Transformer(string) (Transformer, error)
+}
+
+// Transformer : converts a message to the payloads for a connection
+type Transformer interface {
+	Transform(Message) ([][]byte, error)
+}
@@ -1,11 +1,24 @@
 package domain
 
+// Request : a message from the correlated connection waiting for the replies
+type Request struct {
+	ID   string
+	Conn Connection
+	// Original : the value of the correlation key before stamped to restore in the replies
+	Original    interface{}
+	HasOriginal bool
+	// Multiple : the replies are routed until the connection leaves, otherwise only the first reply is routed
+	Multiple bool
+}
+
 // Worker : handles events from connections
 type Worker interface {
 	Run() error
 	Add(Connection) error
 	Delete(Connection) error
-	Receive(Message) error
+	Receive(string, Message) error
+	Expect(Request) error
 	NotifySendResult(error)
 	Finish()
+	Connections() []ConnectionInfo
 }
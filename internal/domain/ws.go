@@ -1,5 +1,10 @@
 package domain
 
+import "time"
+
+// CloseNormalClosure : the close code to end the connection normally
+const CloseNormalClosure = 1000
+
 // WebsocketClientFactory :
 type WebsocketClientFactory interface {
 	Client() (WebsocketClient, error)
@@ -8,7 +13,8 @@ type WebsocketClientFactory interface {
 // WebsocketClient :
 type WebsocketClient interface {
 	Send([]byte) error
-	ReceiveOnce(int) ([]byte, error)
-	Receive(int, func([]byte) error) error
+	ReceiveOnce(time.Duration) ([]byte, error)
+	Receive(time.Duration, func([]byte) error) error
+	SendClose(int, string) error
 	Close() error
 }
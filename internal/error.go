@@ -5,6 +5,64 @@ import "fmt"
 var (
 	// ErrTimeout represents a timeout error
 	ErrTimeout = fmt.Errorf("timeout")
+	// ErrConnectTimeout represents that connecting to the server including the handshake timed out
+	ErrConnectTimeout = fmt.Errorf("connect timeout")
+	// ErrWriteTimeout represents that sending a message timed out
+	ErrWriteTimeout = fmt.Errorf("write timeout")
+	// ErrReplyTimeout represents that the first reply or message didn't arrive in time
+	ErrReplyTimeout = fmt.Errorf("reply timeout")
+	// ErrIdleTimeout represents that the next message didn't arrive in time
+	ErrIdleTimeout = fmt.Errorf("idle timeout")
 	// ErrEOF represents a end of file error
 	ErrEOF = fmt.Errorf("eof")
+	// ErrRemoteClosed represents that the server closed the connection before the expected responses
+	ErrRemoteClosed = fmt.Errorf("connection closed before the responses")
+	// ErrDropped represents that a message is dropped by the full send queue
+	ErrDropped = fmt.Errorf("dropped")
+	// ErrOverflow represents that a connection is disconnected by the full send queue
+	ErrOverflow = fmt.Errorf("send queue overflow")
+	// ErrWorkerStopped represents that the worker already stopped by the shutdown
+	ErrWorkerStopped = fmt.Errorf("worker stopped")
 )
+
+// ConnectionError represents that the server can't be reached like not running
+type ConnectionError struct {
+	Err error
+}
+
+func (e *ConnectionError) Error() string {
+	return e.Err.Error()
+}
+
+// HandshakeError represents that the server rejected the websocket handshake with the http status
+type HandshakeError struct {
+	StatusCode int
+	Body       string
+	Err        error
+}
+
+func (e *HandshakeError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Err, e.Body)
+}
+
+// InputError represents the invalid input like the invalid json or the invalid flag value
+type InputError struct {
+	Err error
+}
+
+func (e *InputError) Error() string {
+	return e.Err.Error()
+}
+
+// CloseError represents that the server closed the connection abnormally like exceeding the message limits
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("closed by the server: %d", e.Code)
+	}
+	return fmt.Sprintf("closed by the server: %d %s", e.Code, e.Reason)
+}
@@ -0,0 +1,88 @@
+package impl
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/notomo/wsxhub/internal/domain"
+)
+
+// AdminServerFactoryImpl :
+type AdminServerFactoryImpl struct {
+	Addresses []string
+	Token     string
+	Workers   []domain.Worker
+	Metrics   *Metrics
+	Logger    domain.Logger
+}
+
+// Server : serves `GET /connections` that returns the connections of all the workers,
+// and `GET /metrics` in the prometheus text format if the metrics are given
+func (factory *AdminServerFactoryImpl) Server() (domain.Server, error) {
+	if err := validateAddresses(factory.Addresses); err != nil {
+		return nil, err
+	}
+	if factory.Token == "" {
+		for _, address := range factory.Addresses {
+			if !isSocketAddress(address) {
+				return nil, errors.New("admin token is required to serve on tcp: " + address)
+			}
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/connections", factory.authorize(factory.connections))
+	if factory.Metrics != nil {
+		mux.HandleFunc("/metrics", factory.authorize(factory.metrics))
+	}
+
+	return &ServerImpl{
+		httpServer: &http.Server{Handler: mux},
+		addresses:  factory.Addresses,
+	}, nil
+}
+
+func (factory *AdminServerFactoryImpl) authorize(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !authorized(req, factory.Token) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			loggerOrDefault(factory.Logger).Warn("unauthorized", "remote", req.RemoteAddr)
+			return
+		}
+		handler(w, req)
+	}
+}
+
+type connectionsResponse struct {
+	Connections []domain.ConnectionInfo `json:"connections"`
+}
+
+func (factory *AdminServerFactoryImpl) connections(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	infos := []domain.ConnectionInfo{}
+	for _, worker := range factory.Workers {
+		infos = append(infos, worker.Connections()...)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(connectionsResponse{Connections: infos}); err != nil {
+		loggerOrDefault(factory.Logger).Error("failed to write connections", "error", err)
+	}
+}
+
+func (factory *AdminServerFactoryImpl) metrics(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := factory.Metrics.Write(w); err != nil {
+		loggerOrDefault(factory.Logger).Error("failed to write metrics", "error", err)
+	}
+}
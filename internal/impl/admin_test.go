@@ -0,0 +1,149 @@
+package impl
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/notomo/wsxhub/internal/domain"
+	"github.com/notomo/wsxhub/internal/mock"
+)
+
+func TestAdminConnections(t *testing.T) {
+	connectedAt := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	newWorker := func(infos ...domain.ConnectionInfo) domain.Worker {
+		return &mock.FakeWorker{
+			FakeConnections: func() []domain.ConnectionInfo {
+				return infos
+			},
+		}
+	}
+	factory := &AdminServerFactoryImpl{
+		Addresses: []string{"127.0.0.1:0"},
+		Token:     "secret",
+		Workers: []domain.Worker{
+			newWorker(domain.ConnectionInfo{Side: "inside", ID: "1", ConnectedAt: connectedAt}),
+			newWorker(),
+		},
+		Metrics: NewMetrics(),
+	}
+	server, err := factory.Server()
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(server.(*ServerImpl).httpServer.Handler)
+	defer httpServer.Close()
+
+	t.Run("ok", func(t *testing.T) {
+		req, err := http.NewRequest("GET", httpServer.URL+"/connections", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if got, want := resp.StatusCode, http.StatusOK; got != want {
+			t.Fatalf("want %v, but %v", want, got)
+		}
+		var got connectionsResponse
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		want := connectionsResponse{
+			Connections: []domain.ConnectionInfo{
+				{Side: "inside", ID: "1", Filter: json.RawMessage("null"), ConnectedAt: connectedAt},
+			},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("want %v, but %v", want, got)
+		}
+	})
+
+	t.Run("metrics", func(t *testing.T) {
+		factory.Metrics.count(metricReceived, "inside")
+
+		resp, err := http.Get(httpServer.URL + "/metrics?token=secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if got, want := resp.StatusCode, http.StatusOK; got != want {
+			t.Fatalf("want %v, but %v", want, got)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(body), `wsxhub_messages_received_total{worker="inside"} 1`; !strings.Contains(got, want) {
+			t.Errorf("should contain %s, but %s", want, got)
+		}
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		resp, err := http.Get(httpServer.URL + "/connections")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if got, want := resp.StatusCode, http.StatusUnauthorized; got != want {
+			t.Errorf("want %v, but %v", want, got)
+		}
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		resp, err := http.Post(httpServer.URL+"/connections?token=secret", "application/json", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if got, want := resp.StatusCode, http.StatusMethodNotAllowed; got != want {
+			t.Errorf("want %v, but %v", want, got)
+		}
+	})
+}
+
+func TestAdminServerWithoutToken(t *testing.T) {
+	tests := []struct {
+		name      string
+		addresses []string
+		valid     bool
+	}{
+		{
+			name:      "tcp",
+			addresses: []string{"127.0.0.1:8003"},
+			valid:     false,
+		},
+		{
+			name:      "socket",
+			addresses: []string{"/tmp/wsxhub-admin.sock"},
+			valid:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			factory := &AdminServerFactoryImpl{Addresses: tt.addresses}
+
+			_, err := factory.Server()
+
+			if tt.valid && err != nil {
+				t.Errorf("should be valid: %s", err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("should be invalid: %v", tt.addresses)
+			}
+		})
+	}
+}
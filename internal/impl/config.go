@@ -0,0 +1,189 @@
+package impl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/notomo/wsxhub/internal/domain"
+)
+
+// ConfigFactoryImpl :
+type ConfigFactoryImpl struct {
+	FilterClauseFactory domain.FilterClauseFactory
+}
+
+// DefaultConfig : the settings used if neither the config file nor the flags have
+func DefaultConfig() *domain.Config {
+	return &domain.Config{
+		Inside: domain.ListenerConfig{
+			Listen: []string{":8002"},
+			Allow:  `^localhost(:\d+)?$`,
+		},
+		Outside: domain.ListenerConfig{
+			Listen: []string{":8001"},
+			Allow:  "localhost:8001",
+		},
+		SendQueueSize:   256,
+		SendQueuePolicy: domain.OverflowPolicyDropOldest,
+		MaxMessageSize:  4 * 1024 * 1024,
+		MaxMessageDepth: 64,
+		MaxBatchLength:  1024,
+	}
+}
+
+// Config : loads the json file over the default settings and validates it
+func (factory *ConfigFactoryImpl) Config(path string) (*domain.Config, error) {
+	config := DefaultConfig()
+	if path == "" {
+		return config, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, decodeError(b, err))
+	}
+
+	if err := factory.Validate(config); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return config, nil
+}
+
+func decodeError(b []byte, err error) error {
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		line, column := position(b, e.Offset)
+		return fmt.Errorf("line %d, column %d: %s", line, column, e)
+	case *json.UnmarshalTypeError:
+		return fmt.Errorf("%s: cannot use %s as %s", e.Field, e.Value, e.Type)
+	}
+	return err
+}
+
+// position : returns the line and column of the byte read last before the error
+func position(b []byte, offset int64) (int, int) {
+	if offset > 0 {
+		offset--
+	}
+	before := b[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndex(before, []byte("\n"))
+	return line, column
+}
+
+// Validate : returns the error prefixed by the offending key like `outside.listen[1]`
+func (factory *ConfigFactoryImpl) Validate(config *domain.Config) error {
+	if err := factory.validateListener("inside", config.Inside); err != nil {
+		return err
+	}
+	if err := factory.validateListener("outside", config.Outside); err != nil {
+		return err
+	}
+	if err := validateAdmin(config.Admin); err != nil {
+		return err
+	}
+	if config.RetainKey != "" {
+		if _, err := parseKeyPath(config.RetainKey); err != nil {
+			return fmt.Errorf("retainKey: %s", err)
+		}
+	}
+	if config.SendQueueSize < 0 {
+		return errors.New("sendQueueSize: must not be negative")
+	}
+	if err := config.SendQueuePolicy.Validate(); err != nil {
+		return fmt.Errorf("sendQueuePolicy: %s", err)
+	}
+	if config.MaxMessageSize < 0 {
+		return errors.New("maxMessageSize: must not be negative")
+	}
+	if config.MaxMessageDepth < 0 {
+		return errors.New("maxMessageDepth: must not be negative")
+	}
+	if config.MaxBatchLength < 0 {
+		return errors.New("maxBatchLength: must not be negative")
+	}
+	return nil
+}
+
+func (factory *ConfigFactoryImpl) validateListener(name string, config domain.ListenerConfig) error {
+	if len(config.Listen) == 0 {
+		return fmt.Errorf("%s.listen: no listen address", name)
+	}
+	for i, address := range config.Listen {
+		if err := validateAddress(address); err != nil {
+			return fmt.Errorf("%s.listen[%d]: %s", name, i, err)
+		}
+	}
+
+	if _, err := regexp.Compile(config.Allow); err != nil {
+		return fmt.Errorf("%s.allow: %s", name, err)
+	}
+
+	for i, origin := range config.AllowOrigins {
+		if _, err := newOriginPatterns([]string{origin}); err != nil {
+			return fmt.Errorf("%s.allowOrigins[%d]: %s", name, i, err)
+		}
+	}
+
+	if config.TokenFile != "" {
+		if _, err := ReadToken(config.TokenFile, ""); err != nil {
+			return fmt.Errorf("%s.tokenFile: %s", name, err)
+		}
+	}
+
+	if (config.TLSCert == "") != (config.TLSKey == "") {
+		return fmt.Errorf("%s.tlsCert, %s.tlsKey: both tls certificate and key are required", name, name)
+	}
+
+	if len(config.DefaultFilter) != 0 {
+		if _, err := factory.FilterClauseFactory.FilterClause(string(config.DefaultFilter)); err != nil {
+			return fmt.Errorf("%s.defaultFilter: %s", name, err)
+		}
+	}
+
+	return nil
+}
+
+func validateAdmin(config domain.AdminConfig) error {
+	for i, address := range config.Listen {
+		if err := validateAddress(address); err != nil {
+			return fmt.Errorf("admin.listen[%d]: %s", i, err)
+		}
+	}
+	if config.TokenFile != "" {
+		if _, err := ReadToken(config.TokenFile, ""); err != nil {
+			return fmt.Errorf("admin.tokenFile: %s", err)
+		}
+	}
+	return nil
+}
+
+// ReadToken : reads the token from the file if given, otherwise from the environment variable
+func ReadToken(file string, envName string) (string, error) {
+	if file == "" {
+		return os.Getenv(envName), nil
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("empty token file: %s", file)
+	}
+	return token, nil
+}
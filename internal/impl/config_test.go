@@ -0,0 +1,169 @@
+package impl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/notomo/wsxhub/internal/domain"
+)
+
+func TestConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsxhub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "wsxhub.json")
+	source := `{
+		"outside": {
+			"listen": ["127.0.0.1:8001", "/tmp/outside.sock"],
+			"allowOrigins": ["chrome-extension://*"],
+			"defaultFilter": {"filters": [{"map": {"method": "open"}}]}
+		},
+		"retainKey": "params.uri",
+		"sendQueuePolicy": "disconnect"
+	}`
+	if err := ioutil.WriteFile(path, []byte(source), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	factory := &ConfigFactoryImpl{FilterClauseFactory: &FilterClauseFactoryImpl{}}
+	got, err := factory.Config(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := DefaultConfig()
+	want.Outside.Listen = []string{"127.0.0.1:8001", "/tmp/outside.sock"}
+	want.Outside.AllowOrigins = []string{"chrome-extension://*"}
+	want.Outside.DefaultFilter = got.Outside.DefaultFilter
+	want.RetainKey = "params.uri"
+	want.SendQueuePolicy = domain.OverflowPolicyDisconnect
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, but %v", want, got)
+	}
+	if string(got.Outside.DefaultFilter) != `{"filters": [{"map": {"method": "open"}}]}` {
+		t.Errorf("unexpected defaultFilter: %s", got.Outside.DefaultFilter)
+	}
+}
+
+func TestConfigWithoutPath(t *testing.T) {
+	factory := &ConfigFactoryImpl{FilterClauseFactory: &FilterClauseFactoryImpl{}}
+	got, err := factory.Config("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := DefaultConfig(); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, but %v", want, got)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{
+			name:   "syntax",
+			source: "{\n  \"retainKey\": \"a\",\n}",
+			want:   "line 3, column 1",
+		},
+		{
+			name:   "unknown key",
+			source: `{"outside": {"port": 8001}}`,
+			want:   `unknown field "port"`,
+		},
+		{
+			name:   "type",
+			source: `{"outside": {"listen": ":8001"}}`,
+			want:   "outside.listen: cannot use string",
+		},
+		{
+			name:   "empty listen",
+			source: `{"inside": {"listen": []}}`,
+			want:   "inside.listen: no listen address",
+		},
+		{
+			name:   "listen address",
+			source: `{"outside": {"listen": [":8001", "127.0.0.1"]}}`,
+			want:   "outside.listen[1]: invalid listen address",
+		},
+		{
+			name:   "allow",
+			source: `{"outside": {"allow": "("}}`,
+			want:   "outside.allow: ",
+		},
+		{
+			name:   "allowOrigins",
+			source: `{"outside": {"allowOrigins": ["https://example.com", "example.com"]}}`,
+			want:   "outside.allowOrigins[1]: origin pattern must have a scheme",
+		},
+		{
+			name:   "tokenFile",
+			source: `{"inside": {"tokenFile": "/notExist/token"}}`,
+			want:   "inside.tokenFile: ",
+		},
+		{
+			name:   "tls",
+			source: `{"outside": {"tlsCert": "cert.pem"}}`,
+			want:   "outside.tlsCert, outside.tlsKey: both tls certificate and key are required",
+		},
+		{
+			name:   "defaultFilter",
+			source: `{"outside": {"defaultFilter": {"operator": "xor"}}}`,
+			want:   "outside.defaultFilter: ",
+		},
+		{
+			name:   "retainKey",
+			source: `{"retainKey": "a..b"}`,
+			want:   "retainKey: invalid key path",
+		},
+		{
+			name:   "sendQueueSize",
+			source: `{"sendQueueSize": -1}`,
+			want:   "sendQueueSize: must not be negative",
+		},
+		{
+			name:   "sendQueuePolicy",
+			source: `{"sendQueuePolicy": "block"}`,
+			want:   "sendQueuePolicy: invalid OverflowPolicy: block",
+		},
+		{
+			name:   "maxMessageSize",
+			source: `{"maxMessageSize": -1}`,
+			want:   "maxMessageSize: must not be negative",
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "wsxhub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "wsxhub.json")
+			if err := ioutil.WriteFile(path, []byte(tt.source), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			factory := &ConfigFactoryImpl{FilterClauseFactory: &FilterClauseFactoryImpl{}}
+			_, err := factory.Config(path)
+			if err == nil {
+				t.Fatal("should be error")
+			}
+
+			if got := err.Error(); !strings.Contains(got, tt.want) {
+				t.Errorf("should contain %q, but %q", tt.want, got)
+			}
+		})
+	}
+}
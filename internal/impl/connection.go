@@ -1,9 +1,17 @@
 package impl
 
 import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
+	"github.com/gorilla/websocket"
+	"github.com/notomo/wsxhub/internal"
 	"github.com/notomo/wsxhub/internal/domain"
+	"github.com/rs/xid"
 )
 
 // ConnectionImpl :
@@ -12,10 +20,27 @@ type ConnectionImpl struct {
 	worker          domain.Worker
 	targetWorker    domain.Worker
 	id              string
+	channel         string
 	filterClause    domain.FilterClause
 	debounce        int
 	debounceTimer   *time.Timer
+	debounced       [][]byte
 	messageFactory  domain.MessageFactory
+	correlationKey  string
+	multipleReplies bool
+	skipRetained    bool
+	transformer     domain.Transformer
+	queue           chan []byte
+	overflowPolicy  domain.OverflowPolicy
+	dropped         int64
+	overflowed      int32
+	sent            int64
+	writeMutex      sync.Mutex
+	remoteAddress   string
+	filterSource    string
+	connectedAt     time.Time
+	side            string
+	metrics         *Metrics
 }
 
 // ID :
@@ -23,6 +48,16 @@ func (conn *ConnectionImpl) ID() string {
 	return conn.id
 }
 
+// Channel :
+func (conn *ConnectionImpl) Channel() string {
+	return conn.channel
+}
+
+// RemoteAddress :
+func (conn *ConnectionImpl) RemoteAddress() string {
+	return conn.remoteAddress
+}
+
 // Close :
 func (conn *ConnectionImpl) Close() error {
 	if err := conn.worker.Delete(conn); err != nil {
@@ -33,38 +68,286 @@ func (conn *ConnectionImpl) Close() error {
 
 // Listen :
 func (conn *ConnectionImpl) Listen() error {
+	if conn.queue != nil {
+		done := make(chan bool)
+		defer close(done)
+		go conn.write(done)
+	}
+
 	if err := conn.worker.Add(conn); err != nil {
 		return err
 	}
 	return conn.websocketClient.Receive(0, func(bytes []byte) error {
 		message, err := conn.messageFactory.FromBytes(bytes)
 		if err != nil {
-			return err
+			return conn.reject(err)
+		}
+
+		if conn.Correlated() {
+			// stamps each map with the own id and keeps the original value to restore in the replies
+			requests := []domain.Request{}
+			message, err = message.ReplaceField(conn.correlationKey, func(original interface{}, ok bool) (interface{}, bool) {
+				request := domain.Request{
+					ID:          xid.New().String(),
+					Conn:        conn,
+					Original:    original,
+					HasOriginal: ok,
+					Multiple:    conn.multipleReplies,
+				}
+				requests = append(requests, request)
+				return request.ID, true
+			})
+			if err != nil {
+				return err
+			}
+			for _, request := range requests {
+				if err := conn.worker.Expect(request); err != nil {
+					return err
+				}
+			}
 		}
 
-		return conn.targetWorker.Receive(message)
+		return conn.targetWorker.Receive(conn.channel, message)
 	})
 }
 
-// Send :
+// maxCloseReasonLength : the close frame payload is up to 125 bytes including the 2 bytes code
+const maxCloseReasonLength = 123
+
+// reject : closes the connection by the invalid message with the reason code
+func (conn *ConnectionImpl) reject(err error) error {
+	messageErr, ok := err.(*MessageError)
+	if !ok {
+		return err
+	}
+	reason := messageErr.Reason
+	if len(reason) > maxCloseReasonLength {
+		reason = reason[:maxCloseReasonLength]
+		for !utf8.ValidString(reason) {
+			reason = reason[:len(reason)-1]
+		}
+	}
+	if closeErr := conn.websocketClient.SendClose(messageErr.Code, reason); closeErr != nil {
+		return fmt.Errorf("%s (failed to close: %s)", err, closeErr)
+	}
+	return err
+}
+
+// Correlated : returns true if the connection receives only the replies to its own messages
+func (conn *ConnectionImpl) Correlated() bool {
+	return conn.correlationKey != ""
+}
+
+// ReceivesRetained : returns true if the connection receives the retained messages on joining
+func (conn *ConnectionImpl) ReceivesRetained() bool {
+	return !conn.skipRetained
+}
+
+// Dropped : returns the count of the messages dropped by the full send queue
+func (conn *ConnectionImpl) Dropped() int {
+	return int(atomic.LoadInt64(&conn.dropped))
+}
+
+// Info : can be called concurrently with sending
+func (conn *ConnectionImpl) Info() domain.ConnectionInfo {
+	var filter json.RawMessage
+	if conn.filterSource != "" {
+		filter = json.RawMessage(conn.filterSource)
+	}
+	return domain.ConnectionInfo{
+		ID:            conn.id,
+		Channel:       conn.channel,
+		RemoteAddress: conn.remoteAddress,
+		Filter:        filter,
+		Debounce:      conn.debounce,
+		ConnectedAt:   conn.connectedAt,
+		Sent:          int(atomic.LoadInt64(&conn.sent)),
+		Dropped:       conn.Dropped(),
+	}
+}
+
+// Send : does nothing after the connection is disconnected by the full send queue
 func (conn *ConnectionImpl) Send(message domain.Message) (bool, error) {
+	if atomic.LoadInt32(&conn.overflowed) == 1 {
+		return false, nil
+	}
+
+	started := time.Now()
 	matched, err := conn.filterClause.Match(message)
+	conn.metrics.observe(metricFilterDuration, conn.side, started)
 	if err != nil {
 		return false, err
 	}
 	if !matched {
+		conn.metrics.count(metricFilteredOut, conn.side)
 		return false, nil
 	}
 
+	payloads, err := conn.payloads(message)
+	if err != nil {
+		return false, err
+	}
+
 	if conn.debounceTimer != nil {
 		conn.debounceTimer.Stop()
 	}
 	if conn.debounce > 0 {
+		conn.metrics.count(metricDebounced, conn.side)
+		conn.debounced = payloads
 		conn.debounceTimer = time.AfterFunc(time.Duration(conn.debounce)*time.Millisecond, func() {
-			err := conn.websocketClient.Send(message.Bytes())
+			_, err := conn.enqueueAll(payloads)
 			conn.worker.NotifySendResult(err)
 		})
 		return false, nil
 	}
-	return true, conn.websocketClient.Send(message.Bytes())
+	return conn.enqueueAll(payloads)
+}
+
+func (conn *ConnectionImpl) payloads(message domain.Message) ([][]byte, error) {
+	if conn.transformer == nil {
+		return [][]byte{message.Bytes()}, nil
+	}
+	return conn.transformer.Transform(message)
+}
+
+func (conn *ConnectionImpl) enqueueAll(payloads [][]byte) (bool, error) {
+	sent := false
+	var dropped error
+	for _, bytes := range payloads {
+		ok, err := conn.enqueue(bytes)
+		if err == internal.ErrDropped {
+			dropped = err
+		} else if err != nil {
+			return false, err
+		}
+		sent = sent || ok
+	}
+	return sent, dropped
+}
+
+func (conn *ConnectionImpl) enqueue(bytes []byte) (bool, error) {
+	if conn.queue == nil {
+		return true, conn.send(bytes)
+	}
+
+	select {
+	case conn.queue <- bytes:
+		return true, nil
+	default:
+	}
+
+	switch conn.overflowPolicy {
+	case domain.OverflowPolicyDropNewest:
+		atomic.AddInt64(&conn.dropped, 1)
+		conn.metrics.count(metricDropped, conn.side)
+		return false, internal.ErrDropped
+	case domain.OverflowPolicyDisconnect:
+		// closes once until the connection leaves
+		if !atomic.CompareAndSwapInt32(&conn.overflowed, 0, 1) {
+			return false, nil
+		}
+		conn.websocketClient.Close()
+		return false, internal.ErrOverflow
+	}
+
+	for {
+		select {
+		case <-conn.queue:
+			atomic.AddInt64(&conn.dropped, 1)
+			conn.metrics.count(metricDropped, conn.side)
+		default:
+		}
+		select {
+		case conn.queue <- bytes:
+			return true, internal.ErrDropped
+		default:
+		}
+	}
+}
+
+func (conn *ConnectionImpl) write(done chan bool) {
+	for {
+		select {
+		case bytes := <-conn.queue:
+			if err := conn.send(bytes); err != nil {
+				conn.worker.NotifySendResult(err)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+func (conn *ConnectionImpl) send(bytes []byte) error {
+	conn.writeMutex.Lock()
+	defer conn.writeMutex.Unlock()
+	started := time.Now()
+	err := conn.websocketClient.Send(bytes)
+	conn.metrics.observe(metricWriteDuration, conn.side, started)
+	if err != nil {
+		conn.metrics.count(metricSendErrors, conn.side)
+		return err
+	}
+	atomic.AddInt64(&conn.sent, 1)
+	conn.metrics.count(metricDelivered, conn.side)
+	return nil
+}
+
+// connectionShutdownTimeout : the stuck client is closed forcibly after this
+var connectionShutdownTimeout = 5 * time.Second
+
+// Shutdown : sends the debounced and queued messages, and then sends a close frame
+// Closes the connection without the close frame if these are not sent in time.
+func (conn *ConnectionImpl) Shutdown() error {
+	finished := make(chan error, 1)
+	go func() {
+		finished <- conn.flush()
+	}()
+
+	timer := time.NewTimer(connectionShutdownTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-finished:
+		return err
+	case <-timer.C:
+		// unblocks the writing to the client
+		conn.websocketClient.Close()
+		return internal.ErrWriteTimeout
+	}
+}
+
+func (conn *ConnectionImpl) flush() error {
+	if atomic.LoadInt32(&conn.overflowed) == 1 {
+		return nil
+	}
+
+	if conn.debounceTimer != nil && conn.debounceTimer.Stop() {
+		if _, err := conn.enqueueAll(conn.debounced); err != nil && err != internal.ErrDropped {
+			return err
+		}
+	}
+
+	if err := conn.drain(); err != nil {
+		return err
+	}
+
+	conn.writeMutex.Lock()
+	defer conn.writeMutex.Unlock()
+	return conn.websocketClient.SendClose(websocket.CloseGoingAway, "server shutdown")
+}
+
+func (conn *ConnectionImpl) drain() error {
+	if conn.queue == nil {
+		return nil
+	}
+	for {
+		select {
+		case bytes := <-conn.queue:
+			if err := conn.send(bytes); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
 }
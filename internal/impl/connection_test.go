@@ -1,10 +1,14 @@
 package impl
 
 import (
+	"encoding/json"
 	"fmt"
+	"reflect"
 	"testing"
 	"time"
 
+	"github.com/gorilla/websocket"
+	"github.com/notomo/wsxhub/internal"
 	"github.com/notomo/wsxhub/internal/domain"
 	"github.com/notomo/wsxhub/internal/mock"
 )
@@ -20,6 +24,44 @@ func TestID(t *testing.T) {
 	}
 }
 
+func TestInfo(t *testing.T) {
+	connectedAt := time.Now()
+	client := &mock.FakeWebsocketClient{
+		FakeSend: func([]byte) error {
+			return nil
+		},
+	}
+	connection := &ConnectionImpl{
+		websocketClient: client,
+		id:              "1",
+		channel:         "neovim",
+		remoteAddress:   "127.0.0.1:50000",
+		filterSource:    `{"filters": []}`,
+		debounce:        100,
+		connectedAt:     connectedAt,
+		dropped:         2,
+	}
+	if err := connection.send([]byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+
+	got := connection.Info()
+
+	want := domain.ConnectionInfo{
+		ID:            "1",
+		Channel:       "neovim",
+		RemoteAddress: "127.0.0.1:50000",
+		Filter:        json.RawMessage(`{"filters": []}`),
+		Debounce:      100,
+		ConnectedAt:   connectedAt,
+		Sent:          1,
+		Dropped:       2,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, but %v:", want, got)
+	}
+}
+
 func TestClose(t *testing.T) {
 
 	t.Run("ok", func(t *testing.T) {
@@ -68,7 +110,7 @@ func TestListen(t *testing.T) {
 	t.Run("ok", func(t *testing.T) {
 		bytes := []byte("message")
 		client := &mock.FakeWebsocketClient{
-			FakeReceive: func(timeout int, callback func([]byte) error) error {
+			FakeReceive: func(timeout time.Duration, callback func([]byte) error) error {
 				return callback(bytes)
 			},
 		}
@@ -80,10 +122,13 @@ func TestListen(t *testing.T) {
 		}
 		message := &mock.FakeMessage{}
 		targetWorker := &mock.FakeWorker{
-			FakeReceive: func(m domain.Message) error {
+			FakeReceive: func(channel string, m domain.Message) error {
 				if message != m {
 					t.Errorf("should be the same message, but actual: %v, %v", message, m)
 				}
+				if want := "neovim"; channel != want {
+					t.Errorf("want %v, but %v:", want, channel)
+				}
 				return nil
 			},
 		}
@@ -101,6 +146,7 @@ func TestListen(t *testing.T) {
 			worker:          worker,
 			targetWorker:    targetWorker,
 			messageFactory:  messageFactory,
+			channel:         "neovim",
 		}
 
 		err := connection.Listen()
@@ -110,9 +156,87 @@ func TestListen(t *testing.T) {
 		}
 	})
 
+	t.Run("correlated", func(t *testing.T) {
+		client := &mock.FakeWebsocketClient{
+			FakeReceive: func(timeout time.Duration, callback func([]byte) error) error {
+				return callback([]byte("message"))
+			},
+		}
+
+		expected := []domain.Request{}
+		stampedIDs := []interface{}{}
+		worker := &mock.FakeWorker{
+			FakeAdd: func(connection domain.Connection) error {
+				return nil
+			},
+			FakeExpect: func(request domain.Request) error {
+				expected = append(expected, request)
+				return nil
+			},
+		}
+		stamped := &mock.FakeMessage{}
+		message := &mock.FakeMessage{
+			FakeReplaceField: func(key string, replace func(interface{}, bool) (interface{}, bool)) (domain.Message, error) {
+				if key != "id" {
+					t.Errorf("want %v, but %v:", "id", key)
+				}
+				// a batch of the map with the id and the map without the id
+				for _, original := range []interface{}{"1", nil} {
+					id, ok := replace(original, original != nil)
+					if !ok {
+						t.Errorf("should stamp the id")
+					}
+					stampedIDs = append(stampedIDs, id)
+				}
+				return stamped, nil
+			},
+		}
+		targetWorker := &mock.FakeWorker{
+			FakeReceive: func(channel string, m domain.Message) error {
+				if stamped != m {
+					t.Errorf("should be the stamped message, but actual: %v", m)
+				}
+				return nil
+			},
+		}
+		messageFactory := &mock.FakeMessageFactory{
+			FakeFromBytes: func(b []byte) (domain.Message, error) {
+				return message, nil
+			},
+		}
+
+		connection := &ConnectionImpl{
+			websocketClient: client,
+			worker:          worker,
+			targetWorker:    targetWorker,
+			messageFactory:  messageFactory,
+			correlationKey:  "id",
+		}
+
+		err := connection.Listen()
+
+		if err != nil {
+			t.Errorf("should not be error, but actual: %v", err)
+		}
+		if len(expected) != 2 || expected[0].ID == expected[1].ID {
+			t.Fatalf("should expect the replies of the different ids, but actual: %v", expected)
+		}
+		for i, request := range expected {
+			if request.ID != stampedIDs[i] {
+				t.Errorf("should expect the reply of the stamped id, but actual: %v, %v", request.ID, stampedIDs[i])
+			}
+		}
+		if !expected[0].HasOriginal || expected[0].Original != "1" {
+			t.Errorf("should keep the original id, but actual: %v", expected[0])
+		}
+		if expected[1].HasOriginal {
+			t.Errorf("should keep that the original id is absent, but actual: %v", expected[1])
+		}
+	})
+
 	t.Run("fail to create message", func(t *testing.T) {
 		client := &mock.FakeWebsocketClient{
-			FakeReceive: func(timeout int, callback func([]byte) error) error {
+			FakeReceive: func(timeout time.Duration, callback func([]byte) error) error {
 				return callback([]byte(""))
 			},
 		}
@@ -142,6 +266,45 @@ func TestListen(t *testing.T) {
 		}
 	})
 
+	t.Run("reject message", func(t *testing.T) {
+		var closedCode int
+		var closedReason string
+		client := &mock.FakeWebsocketClient{
+			FakeReceive: func(timeout time.Duration, callback func([]byte) error) error {
+				return callback([]byte("[{}, {}]"))
+			},
+			FakeSendClose: func(code int, reason string) error {
+				closedCode = code
+				closedReason = reason
+				return nil
+			},
+		}
+
+		worker := &mock.FakeWorker{
+			FakeAdd: func(connection domain.Connection) error {
+				return nil
+			},
+		}
+
+		connection := &ConnectionImpl{
+			websocketClient: client,
+			worker:          worker,
+			messageFactory:  &MessageFactoryImpl{MaxBatchLength: 1},
+		}
+
+		err := connection.Listen()
+
+		if err == nil {
+			t.Errorf("should be error, but actual nil")
+		}
+		if want := websocket.ClosePolicyViolation; closedCode != want {
+			t.Errorf("want %v, but %v:", want, closedCode)
+		}
+		if want := "batch length 2 exceeds the limit 1"; closedReason != want {
+			t.Errorf("want %v, but %v:", want, closedReason)
+		}
+	})
+
 	t.Run("fail to add connection", func(t *testing.T) {
 		worker := &mock.FakeWorker{
 			FakeAdd: func(connection domain.Connection) error {
@@ -238,6 +401,50 @@ func TestSend(t *testing.T) {
 		}
 	})
 
+	t.Run("transformed", func(t *testing.T) {
+		written := []string{}
+		client := &mock.FakeWebsocketClient{
+			FakeSend: func(b []byte) error {
+				written = append(written, string(b))
+				return nil
+			},
+		}
+
+		message := &mock.FakeMessage{}
+
+		filterClause := &mock.FakeFilterClause{
+			FakeMatch: func(_ domain.Message) (bool, error) {
+				return true, nil
+			},
+		}
+
+		transformer := &mock.FakeTransformer{
+			FakeTransform: func(m domain.Message) ([][]byte, error) {
+				if message != m {
+					t.Errorf("should be the same message, but actual: %v, %v", message, m)
+				}
+				return [][]byte{[]byte("1"), []byte("2")}, nil
+			},
+		}
+
+		connection := &ConnectionImpl{
+			websocketClient: client,
+			filterClause:    filterClause,
+			transformer:     transformer,
+		}
+
+		sent, err := connection.Send(message)
+		if sent == false {
+			t.Errorf("should send")
+		}
+		if err != nil {
+			t.Errorf("should not be error, but actual: %v", err)
+		}
+		if want := []string{"1", "2"}; fmt.Sprint(written) != fmt.Sprint(want) {
+			t.Errorf("want %v, but %v:", want, written)
+		}
+	})
+
 	t.Run("timer stop and start", func(t *testing.T) {
 		client := &mock.FakeWebsocketClient{
 			FakeSend: func(b []byte) error {
@@ -287,4 +494,256 @@ func TestSend(t *testing.T) {
 			t.Fatalf("should be notified")
 		}
 	})
+	t.Run("full queue", func(t *testing.T) {
+		tests := []struct {
+			name       string
+			policy     domain.OverflowPolicy
+			wantSent   bool
+			wantErr    error
+			wantQueued string
+			wantClosed bool
+		}{
+			{
+				name:       "drop oldest",
+				policy:     domain.OverflowPolicyDropOldest,
+				wantSent:   true,
+				wantErr:    internal.ErrDropped,
+				wantQueued: "new",
+			},
+			{
+				name:       "drop newest",
+				policy:     domain.OverflowPolicyDropNewest,
+				wantSent:   false,
+				wantErr:    internal.ErrDropped,
+				wantQueued: "old",
+			},
+			{
+				name:       "disconnect",
+				policy:     domain.OverflowPolicyDisconnect,
+				wantSent:   false,
+				wantErr:    internal.ErrOverflow,
+				wantQueued: "old",
+				wantClosed: true,
+			},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				closed := false
+				client := &mock.FakeWebsocketClient{
+					FakeClose: func() error {
+						closed = true
+						return nil
+					},
+				}
+
+				message := &mock.FakeMessage{
+					FakeBytes: func() []byte {
+						return []byte("new")
+					},
+				}
+
+				filterClause := &mock.FakeFilterClause{
+					FakeMatch: func(_ domain.Message) (bool, error) {
+						return true, nil
+					},
+				}
+
+				connection := &ConnectionImpl{
+					websocketClient: client,
+					filterClause:    filterClause,
+					queue:           make(chan []byte, 1),
+					overflowPolicy:  test.policy,
+				}
+				connection.queue <- []byte("old")
+
+				sent, err := connection.Send(message)
+				if sent != test.wantSent {
+					t.Errorf("want %v, but %v:", test.wantSent, sent)
+				}
+				if err != test.wantErr {
+					t.Errorf("want %v, but %v:", test.wantErr, err)
+				}
+				if got := string(<-connection.queue); got != test.wantQueued {
+					t.Errorf("want %v, but %v:", test.wantQueued, got)
+				}
+				if closed != test.wantClosed {
+					t.Errorf("want %v, but %v:", test.wantClosed, closed)
+				}
+
+				wantDropped := 1
+				if test.wantClosed {
+					wantDropped = 0
+				}
+				if got := connection.Dropped(); got != wantDropped {
+					t.Errorf("want %v, but %v:", wantDropped, got)
+				}
+			})
+		}
+	})
+
+	t.Run("after disconnected by full queue", func(t *testing.T) {
+		closed := 0
+		client := &mock.FakeWebsocketClient{
+			FakeClose: func() error {
+				closed++
+				return nil
+			},
+		}
+
+		message := &mock.FakeMessage{
+			FakeBytes: func() []byte {
+				return []byte("new")
+			},
+		}
+
+		filterClause := &mock.FakeFilterClause{
+			FakeMatch: func(_ domain.Message) (bool, error) {
+				return true, nil
+			},
+		}
+
+		connection := &ConnectionImpl{
+			websocketClient: client,
+			filterClause:    filterClause,
+			queue:           make(chan []byte, 1),
+			overflowPolicy:  domain.OverflowPolicyDisconnect,
+		}
+		connection.queue <- []byte("old")
+
+		if _, err := connection.Send(message); err != internal.ErrOverflow {
+			t.Fatalf("want %v, but %v:", internal.ErrOverflow, err)
+		}
+		for i := 0; i < 2; i++ {
+			sent, err := connection.Send(message)
+			if sent || err != nil {
+				t.Errorf("should do nothing, but %v, %v:", sent, err)
+			}
+		}
+		if got, want := closed, 1; got != want {
+			t.Errorf("want %v, but %v:", want, got)
+		}
+	})
+
+	t.Run("write queued", func(t *testing.T) {
+		written := make(chan []byte)
+		client := &mock.FakeWebsocketClient{
+			FakeSend: func(b []byte) error {
+				written <- b
+				return nil
+			},
+			FakeReceive: func(timeout time.Duration, callback func([]byte) error) error {
+				<-time.After(100 * time.Millisecond)
+				return nil
+			},
+		}
+
+		bytes := []byte("message")
+		message := &mock.FakeMessage{
+			FakeBytes: func() []byte {
+				return bytes
+			},
+		}
+
+		filterClause := &mock.FakeFilterClause{
+			FakeMatch: func(_ domain.Message) (bool, error) {
+				return true, nil
+			},
+		}
+
+		connection := &ConnectionImpl{
+			websocketClient: client,
+			filterClause:    filterClause,
+			queue:           make(chan []byte, 1),
+		}
+		connection.worker = &mock.FakeWorker{
+			FakeAdd: func(_ domain.Connection) error {
+				if _, err := connection.Send(message); err != nil {
+					t.Errorf("should not be error, but actual: %v", err)
+				}
+				return nil
+			},
+		}
+
+		go connection.Listen()
+
+		select {
+		case got := <-written:
+			if string(got) != string(bytes) {
+				t.Errorf("want %v, but %v:", string(bytes), string(got))
+			}
+		case <-time.After(1 * time.Second):
+			t.Fatalf("should be written")
+		}
+	})
+}
+
+func TestShutdown(t *testing.T) {
+	written := []string{}
+	closed := false
+	client := &mock.FakeWebsocketClient{
+		FakeSend: func(b []byte) error {
+			written = append(written, string(b))
+			return nil
+		},
+		FakeSendClose: func(code int, reason string) error {
+			closed = true
+			return nil
+		},
+	}
+
+	connection := &ConnectionImpl{
+		websocketClient: client,
+		queue:           make(chan []byte, 2),
+		debounceTimer:   time.NewTimer(1 * time.Minute),
+		debounced:       [][]byte{[]byte("debounced")},
+	}
+	connection.queue <- []byte("queued")
+
+	if err := connection.Shutdown(); err != nil {
+		t.Fatalf("should not be error: %v", err)
+	}
+
+	want := []string{"queued", "debounced"}
+	if fmt.Sprint(written) != fmt.Sprint(want) {
+		t.Errorf("want %v, but %v:", want, written)
+	}
+	if !closed {
+		t.Errorf("should send a close frame")
+	}
+}
+
+func TestShutdownStuck(t *testing.T) {
+	defer func(timeout time.Duration) {
+		connectionShutdownTimeout = timeout
+	}(connectionShutdownTimeout)
+	connectionShutdownTimeout = 10 * time.Millisecond
+
+	unblocked := make(chan bool)
+	client := &mock.FakeWebsocketClient{
+		FakeSend: func(b []byte) error {
+			<-unblocked
+			return internal.ErrEOF
+		},
+		FakeClose: func() error {
+			close(unblocked)
+			return nil
+		},
+	}
+
+	connection := &ConnectionImpl{
+		websocketClient: client,
+		queue:           make(chan []byte, 1),
+	}
+	connection.queue <- []byte("queued")
+
+	if err := connection.Shutdown(); err != internal.ErrWriteTimeout {
+		t.Fatalf("want error %v, but %v:", internal.ErrWriteTimeout, err)
+	}
+
+	select {
+	case <-unblocked:
+	default:
+		t.Errorf("should close the stuck client")
+	}
 }
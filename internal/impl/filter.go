@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
 	"regexp"
 
 	"github.com/notomo/wsxhub/internal/domain"
@@ -24,18 +25,43 @@ func (factory *FilterClauseFactoryImpl) FilterClause(source string) (domain.Filt
 		return nil, err
 	}
 
-	if err := filterClause.OperatorType.Validate(); err != nil {
+	if err := filterClause.compile(); err != nil {
 		return nil, err
 	}
 
-	if err := filterClause.BatchOperatorType.Validate(); err != nil {
-		return nil, err
+	return &filterClause, nil
+}
+
+// compile : validates the clause and the sub clauses recursively
+func (clause *FilterClauseImpl) compile() error {
+	if err := clause.OperatorType.Validate(); err != nil {
+		return err
+	}
+
+	if err := clause.BatchOperatorType.Validate(); err != nil {
+		return err
 	}
 
-	for i, filter := range filterClause.Filters {
+	for i, filter := range clause.Filters {
 		filter := filter
 		if err := filter.MatchType.Validate(); err != nil {
-			return nil, err
+			return err
+		}
+
+		pathFilters, err := toPathFilters(filter.Paths, filter.MatchType)
+		if err != nil {
+			return err
+		}
+		clause.Filters[i].pathFilters = pathFilters
+
+		if filter.MatchType.IsComparison() {
+			if err := validateComparisonMap(filter.MatchType, filter.Map); err != nil {
+				return err
+			}
+			if err := validateComparisonMap(filter.MatchType, filter.Paths); err != nil {
+				return err
+			}
+			continue
 		}
 
 		if filter.MatchType != domain.MatchTypeRegexp {
@@ -43,12 +69,18 @@ func (factory *FilterClauseFactoryImpl) FilterClause(source string) (domain.Filt
 		}
 		regexpMap, err := toRegexpMap(filter.Map)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		filterClause.Filters[i].Map = regexpMap
+		clause.Filters[i].Map = regexpMap
 	}
 
-	return &filterClause, nil
+	for i := range clause.Clauses {
+		if err := clause.Clauses[i].compile(); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func toRegexpMap(filterMap map[string]interface{}) (map[string]interface{}, error) {
@@ -80,21 +112,128 @@ func toRegexpMap(filterMap map[string]interface{}) (map[string]interface{}, erro
 	return regexpMap, nil
 }
 
+func validateComparisonMap(matchType domain.MatchType, filterMap map[string]interface{}) error {
+	for key, value := range filterMap {
+		if nestMap, nested := value.(map[string]interface{}); nested {
+			if err := validateComparisonMap(matchType, nestMap); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := validateComparisonValue(matchType, value); err != nil {
+			return fmt.Errorf("%s: %s", key, err)
+		}
+	}
+	return nil
+}
+
+func validateComparisonValue(matchType domain.MatchType, value interface{}) error {
+	switch matchType {
+	case domain.MatchTypeIn:
+		if _, ok := value.([]interface{}); !ok {
+			return fmt.Errorf("in filter values must be array, but actual: %v", value)
+		}
+		return nil
+	case domain.MatchTypeBetween:
+		bounds, ok := value.([]interface{})
+		if !ok || len(bounds) != 2 {
+			return fmt.Errorf("between filter values must be [min, max], but actual: %v", value)
+		}
+		min, minOk := toNumber(bounds[0])
+		max, maxOk := toNumber(bounds[1])
+		if !minOk || !maxOk {
+			return fmt.Errorf("between filter values must be numbers, but actual: %v", value)
+		}
+		if min > max {
+			return fmt.Errorf("between filter values must be min <= max, but actual: %v", value)
+		}
+		return nil
+	}
+	if _, ok := toNumber(value); !ok {
+		return fmt.Errorf("%s filter values must be number, but actual: %v", matchType, value)
+	}
+	return nil
+}
+
+func toPathFilters(paths map[string]interface{}, matchType domain.MatchType) ([]pathFilter, error) {
+	var pathFilters []pathFilter
+	for source, value := range paths {
+		path, err := parseKeyPath(source)
+		if err != nil {
+			return nil, err
+		}
+
+		if matchType == domain.MatchTypeRegexp {
+			regexpMap, err := toRegexpMap(map[string]interface{}{source: value})
+			if err != nil {
+				return nil, err
+			}
+			value = regexpMap[source]
+		}
+
+		pathFilters = append(pathFilters, pathFilter{path: path, value: value})
+	}
+	return pathFilters, nil
+}
+
 // FilterClauseImpl :
 type FilterClauseImpl struct {
 	OperatorType      domain.OperatorType `json:"operator"`
 	BatchOperatorType domain.OperatorType `json:"batchOperator"`
 	Filters           []FilterImpl        `json:"filters"`
+	Clauses           []FilterClauseImpl  `json:"clauses"`
 	Not               bool                `json:"not"`
 }
 
 // Match :
 func (clause *FilterClauseImpl) Match(message domain.Message) (bool, error) {
-	if len(clause.Filters) == 0 {
+	if len(clause.Filters) == 0 && len(clause.Clauses) == 0 {
 		return !clause.Not, nil
 	}
-	targetMaps := message.Unmarshaled()
 
+	matched, err := clause.match(message)
+	if clause.Not {
+		return !matched, err
+	}
+	return matched, err
+}
+
+// match : combines the filters and the sub clauses by the operator
+func (clause *FilterClauseImpl) match(message domain.Message) (bool, error) {
+	var and bool
+	switch clause.OperatorType {
+	case domain.OperatorTypeAnd:
+		and = true
+	case domain.OperatorTypeOr, domain.OperatorTypeDefault:
+		and = false
+	default:
+		return false, errors.New("maybe operator type is not validated: " + string(clause.OperatorType))
+	}
+
+	if len(clause.Filters) > 0 {
+		matched, err := clause.filtersMatch(message.Unmarshaled())
+		if err != nil {
+			return false, err
+		}
+		if matched != and {
+			return matched, nil
+		}
+	}
+
+	for _, subClause := range clause.Clauses {
+		matched, err := subClause.Match(message)
+		if err != nil {
+			return false, err
+		}
+		if matched != and {
+			return matched, nil
+		}
+	}
+
+	return and, nil
+}
+
+func (clause *FilterClauseImpl) filtersMatch(targetMaps []map[string]interface{}) (bool, error) {
 	var matched bool
 	var err error
 	switch clause.OperatorType {
@@ -119,10 +258,6 @@ func (clause *FilterClauseImpl) Match(message domain.Message) (bool, error) {
 	default:
 		return false, errors.New("maybe operator type is not validated: " + string(clause.OperatorType))
 	}
-
-	if clause.Not {
-		return !matched, err
-	}
 	return matched, err
 }
 
@@ -198,12 +333,80 @@ func (clause *FilterClauseImpl) orMatchOne(targetMaps []map[string]interface{})
 
 // FilterImpl :
 type FilterImpl struct {
-	MatchType domain.MatchType       `json:"type"`
-	Map       map[string]interface{} `json:"map"`
+	MatchType   domain.MatchType       `json:"type"`
+	Map         map[string]interface{} `json:"map"`
+	Paths       map[string]interface{} `json:"paths"`
+	pathFilters []pathFilter
+}
+
+type pathFilter struct {
+	path  keyPath
+	value interface{}
 }
 
 // Match :
 func (filter *FilterImpl) Match(targetMap map[string]interface{}) (bool, error) {
+	if filter.Map == nil && len(filter.pathFilters) > 0 {
+		return filter.pathMatch(targetMap)
+	}
+
+	matched, err := filter.mapMatch(targetMap)
+	if err != nil || !matched {
+		return matched, err
+	}
+	return filter.pathMatch(targetMap)
+}
+
+func (filter *FilterImpl) pathMatch(targetMap map[string]interface{}) (bool, error) {
+	for _, pathFilter := range filter.pathFilters {
+		matched := false
+		for _, targetValue := range pathFilter.path.Lookup(targetMap) {
+			ok, err := valueMatch(filter.MatchType, pathFilter.value, targetValue)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func valueMatch(matchType domain.MatchType, filterValue interface{}, targetValue interface{}) (bool, error) {
+	filterMap, nested := filterValue.(map[string]interface{})
+	targetMap, nestedTarget := targetValue.(map[string]interface{})
+	if nested {
+		if !nestedTarget {
+			return false, nil
+		}
+		filter := &FilterImpl{MatchType: matchType, Map: filterMap}
+		return filter.mapMatch(targetMap)
+	}
+
+	switch matchType {
+	case domain.MatchTypeExact, domain.MatchTypeContained, domain.MatchTypeContain, domain.MatchTypeDefault:
+		return reflect.DeepEqual(filterValue, targetValue), nil
+	case domain.MatchTypeExactKey, domain.MatchTypeContainedKey, domain.MatchTypeContainKey:
+		return true, nil
+	case domain.MatchTypeRegexp:
+		targetString, ok := targetValue.(string)
+		if !ok {
+			return false, nil
+		}
+		return filterValue.(*regexp.Regexp).MatchString(targetString), nil
+	}
+	if matchType.IsComparison() {
+		return compare(matchType, filterValue, targetValue), nil
+	}
+	return false, errors.New("maybe match type is not validated: " + string(matchType))
+}
+
+func (filter *FilterImpl) mapMatch(targetMap map[string]interface{}) (bool, error) {
 	switch filter.MatchType {
 	case domain.MatchTypeExact:
 		return isSubset(filter.Map, targetMap) && isSubset(targetMap, filter.Map), nil
@@ -220,6 +423,9 @@ func (filter *FilterImpl) Match(targetMap map[string]interface{}) (bool, error)
 	case domain.MatchTypeContainKey:
 		return isSubsetKey(targetMap, filter.Map), nil
 	}
+	if filter.MatchType.IsComparison() {
+		return compareMatch(filter.MatchType, filter.Map, targetMap), nil
+	}
 	return false, errors.New("maybe match type is not validated: " + string(filter.MatchType))
 }
 
@@ -285,7 +491,7 @@ func isSubset(filterMap map[string]interface{}, targetMap map[string]interface{}
 		if nested != nestedTarget {
 			return false
 		}
-		if !nested && targetValue != value {
+		if !nested && !reflect.DeepEqual(targetValue, value) {
 			return false
 		}
 		if nested && !isSubset(nestMap, nestTargetMap) {
@@ -294,3 +500,94 @@ func isSubset(filterMap map[string]interface{}, targetMap map[string]interface{}
 	}
 	return true
 }
+
+func compareMatch(matchType domain.MatchType, filterMap map[string]interface{}, targetMap map[string]interface{}) bool {
+	for key, value := range filterMap {
+		targetValue, ok := targetMap[key]
+		if !ok {
+			return false
+		}
+
+		nestMap, nested := value.(map[string]interface{})
+		nestTargetMap, nestedTarget := targetValue.(map[string]interface{})
+		if nested != nestedTarget {
+			return false
+		}
+		if !nested && !compare(matchType, value, targetValue) {
+			return false
+		}
+		if nested && !compareMatch(matchType, nestMap, nestTargetMap) {
+			return false
+		}
+	}
+	return true
+}
+
+func compare(matchType domain.MatchType, filterValue interface{}, targetValue interface{}) bool {
+	if matchType == domain.MatchTypeIn {
+		values, _ := filterValue.([]interface{})
+		for _, value := range values {
+			if jsonEqual(value, targetValue) {
+				return true
+			}
+		}
+		return false
+	}
+
+	target, ok := toNumber(targetValue)
+	if !ok {
+		return false
+	}
+
+	if matchType == domain.MatchTypeBetween {
+		bounds, _ := filterValue.([]interface{})
+		if len(bounds) != 2 {
+			return false
+		}
+		min, minOk := toNumber(bounds[0])
+		max, maxOk := toNumber(bounds[1])
+		return minOk && maxOk && min <= target && target <= max
+	}
+
+	value, ok := toNumber(filterValue)
+	if !ok {
+		return false
+	}
+	switch matchType {
+	case domain.MatchTypeGreaterThan:
+		return target > value
+	case domain.MatchTypeGreaterThanOrEqual:
+		return target >= value
+	case domain.MatchTypeLessThan:
+		return target < value
+	case domain.MatchTypeLessThanOrEqual:
+		return target <= value
+	}
+	return false
+}
+
+func jsonEqual(value interface{}, targetValue interface{}) bool {
+	number, isNumber := toNumber(value)
+	targetNumber, isTargetNumber := toNumber(targetValue)
+	if isNumber || isTargetNumber {
+		return isNumber && isTargetNumber && number == targetNumber
+	}
+	return reflect.DeepEqual(value, targetValue)
+}
+
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
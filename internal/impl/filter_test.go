@@ -1,6 +1,7 @@
 package impl
 
 import (
+	"encoding/json"
 	"reflect"
 	"regexp"
 	"testing"
@@ -48,6 +49,26 @@ func TestFilterClause(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:   "nested",
+			source: `{"operator": "or", "clauses": [{"not": true, "filters": [{"type": "regexp", "map": {"name": "^Hoge"}}]}]}`,
+			want: FilterClauseImpl{
+				OperatorType: domain.OperatorTypeOr,
+				Clauses: []FilterClauseImpl{
+					{
+						Not: true,
+						Filters: []FilterImpl{
+							{
+								Map: map[string]interface{}{
+									"name": regexp.MustCompile("^Hoge"),
+								},
+								MatchType: domain.MatchTypeRegexp,
+							},
+						},
+					},
+				},
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -72,6 +93,9 @@ func TestFilterClause(t *testing.T) {
 			if got, want := filterClauseImpl.Filters, test.want.Filters; !reflect.DeepEqual(got, want) {
 				t.Errorf("Filters length: want %v, but %v:", want, got)
 			}
+			if got, want := filterClauseImpl.Clauses, test.want.Clauses; !reflect.DeepEqual(got, want) {
+				t.Errorf("Clauses: want %v, but %v:", want, got)
+			}
 		})
 	}
 }
@@ -866,3 +890,532 @@ func TestContainKey(t *testing.T) {
 		}
 	})
 }
+
+func TestInvalidFilterClause(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{
+			name:   "invalid json",
+			source: `{`,
+		},
+		{
+			name:   "invalid operator",
+			source: `{"operator": "xor"}`,
+		},
+		{
+			name:   "invalid match type",
+			source: `{"filters": [{"type": "invalid", "map": {}}]}`,
+		},
+		{
+			name:   "invalid regexp",
+			source: `{"filters": [{"type": "regexp", "map": {"name": "("}}]}`,
+		},
+		{
+			name:   "invalid path",
+			source: `{"filters": [{"paths": {"items[x]": "value"}}]}`,
+		},
+		{
+			name:   "not string regexp path value",
+			source: `{"filters": [{"type": "regexp", "paths": {"items[0]": 1}}]}`,
+		},
+		{
+			name:   "not number gt value",
+			source: `{"filters": [{"type": "gt", "map": {"progress": "50"}}]}`,
+		},
+		{
+			name:   "not number nested lte value",
+			source: `{"filters": [{"type": "lte", "map": {"params": {"progress": true}}}]}`,
+		},
+		{
+			name:   "not array in value",
+			source: `{"filters": [{"type": "in", "map": {"severity": 1}}]}`,
+		},
+		{
+			name:   "not pair between value",
+			source: `{"filters": [{"type": "between", "map": {"severity": [1, 2, 3]}}]}`,
+		},
+		{
+			name:   "not number between value",
+			source: `{"filters": [{"type": "between", "map": {"severity": [1, "4"]}}]}`,
+		},
+		{
+			name:   "reversed between value",
+			source: `{"filters": [{"type": "between", "map": {"severity": [4, 2]}}]}`,
+		},
+		{
+			name:   "invalid nested operator",
+			source: `{"clauses": [{"clauses": [{"operator": "xor"}]}]}`,
+		},
+		{
+			name:   "invalid nested filter",
+			source: `{"clauses": [{"filters": [{"type": "gt", "map": {"progress": "50"}}]}]}`,
+		},
+		{
+			name:   "not number gte path value",
+			source: `{"filters": [{"type": "gte", "paths": {"items[0].progress": null}}]}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			factory := &FilterClauseFactoryImpl{}
+			if _, err := factory.FilterClause(test.source); err == nil {
+				t.Errorf("should be error")
+			}
+		})
+	}
+}
+
+func TestPathMatch(t *testing.T) {
+	type S = map[string]interface{}
+	type A = []interface{}
+
+	target := S{
+		"params": S{
+			"items": A{
+				S{"uri": "file:///a", "line": float64(1)},
+				S{"uri": "file:///b", "line": float64(2)},
+			},
+		},
+		"tags": A{"x", "y"},
+	}
+
+	tests := []struct {
+		name      string
+		matchType domain.MatchType
+		paths     S
+		want      bool
+	}{
+		{
+			name:      "index",
+			matchType: domain.MatchTypeContained,
+			paths:     S{"params.items[0].uri": "file:///a"},
+			want:      true,
+		},
+		{
+			name:      "index, other value",
+			matchType: domain.MatchTypeContained,
+			paths:     S{"params.items[1].uri": "file:///a"},
+			want:      false,
+		},
+		{
+			name:      "any element",
+			matchType: domain.MatchTypeExact,
+			paths:     S{"tags[*]": "y"},
+			want:      true,
+		},
+		{
+			name:      "no element",
+			matchType: domain.MatchTypeExact,
+			paths:     S{"tags[*]": "z"},
+			want:      false,
+		},
+		{
+			name:      "all paths",
+			matchType: domain.MatchTypeContained,
+			paths:     S{"tags[*]": "x", "params.items[*].line": float64(2)},
+			want:      true,
+		},
+		{
+			name:      "one of paths",
+			matchType: domain.MatchTypeContained,
+			paths:     S{"tags[*]": "x", "params.items[*].line": float64(3)},
+			want:      false,
+		},
+		{
+			name:      "contained map",
+			matchType: domain.MatchTypeContained,
+			paths:     S{"params.items[*]": S{"uri": "file:///b"}},
+			want:      true,
+		},
+		{
+			name:      "exact map",
+			matchType: domain.MatchTypeExact,
+			paths:     S{"params.items[*]": S{"uri": "file:///b"}},
+			want:      false,
+		},
+		{
+			name:      "contain map",
+			matchType: domain.MatchTypeContain,
+			paths:     S{"params.items[0]": S{"uri": "file:///a", "line": float64(1), "other": "value"}},
+			want:      true,
+		},
+		{
+			name:      "key",
+			matchType: domain.MatchTypeContainedKey,
+			paths:     S{"params.items[1].line": nil},
+			want:      true,
+		},
+		{
+			name:      "no key",
+			matchType: domain.MatchTypeContainedKey,
+			paths:     S{"params.items[2].line": nil},
+			want:      false,
+		},
+		{
+			name:      "exact key map",
+			matchType: domain.MatchTypeExactKey,
+			paths:     S{"params.items[*]": S{"uri": nil, "line": nil}},
+			want:      true,
+		},
+		{
+			name:      "regexp",
+			matchType: domain.MatchTypeRegexp,
+			paths:     S{"params.items[*].uri": "/b$"},
+			want:      true,
+		},
+		{
+			name:      "regexp, not string target",
+			matchType: domain.MatchTypeRegexp,
+			paths:     S{"params.items[*].line": ".*"},
+			want:      false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pathFilters, err := toPathFilters(test.paths, test.matchType)
+			if err != nil {
+				t.Fatalf("should not be error: %v", err)
+			}
+			f := FilterImpl{
+				MatchType:   test.matchType,
+				Paths:       test.paths,
+				pathFilters: pathFilters,
+			}
+
+			got, err := f.Match(target)
+			if err != nil {
+				t.Fatalf("should not be error: %v", err)
+			}
+
+			if got != test.want {
+				t.Errorf("want %v, but %v:", test.want, got)
+			}
+		})
+	}
+
+	t.Run("with map", func(t *testing.T) {
+		factory := &FilterClauseFactoryImpl{}
+		filterClause, err := factory.FilterClause(`{"filters": [{"map": {"tags": ["x", "y"]}, "paths": {"tags[0]": "y"}}]}`)
+		if err != nil {
+			t.Fatalf("should not be error: %v", err)
+		}
+		message := &mock.FakeMessage{
+			FakeUnmarshaled: func() []map[string]interface{} {
+				return []map[string]interface{}{target}
+			},
+		}
+
+		got, err := filterClause.Match(message)
+		if err != nil {
+			t.Fatalf("should not be error: %v", err)
+		}
+		if got {
+			t.Errorf("should not match if the paths don't match")
+		}
+	})
+}
+
+func TestComparisonMatch(t *testing.T) {
+	type S = map[string]interface{}
+	type A = []interface{}
+
+	tests := []struct {
+		name      string
+		matchType domain.MatchType
+		target    S
+		filter    S
+		want      bool
+	}{
+		{
+			name:      "gt",
+			matchType: domain.MatchTypeGreaterThan,
+			filter:    S{"progress": float64(50)},
+			target:    S{"progress": float64(51)},
+			want:      true,
+		},
+		{
+			name:      "gt, equal",
+			matchType: domain.MatchTypeGreaterThan,
+			filter:    S{"progress": float64(50)},
+			target:    S{"progress": float64(50)},
+			want:      false,
+		},
+		{
+			name:      "gte, equal",
+			matchType: domain.MatchTypeGreaterThanOrEqual,
+			filter:    S{"progress": float64(50)},
+			target:    S{"progress": float64(50)},
+			want:      true,
+		},
+		{
+			name:      "gte, less",
+			matchType: domain.MatchTypeGreaterThanOrEqual,
+			filter:    S{"progress": float64(50)},
+			target:    S{"progress": float64(49.5)},
+			want:      false,
+		},
+		{
+			name:      "lt",
+			matchType: domain.MatchTypeLessThan,
+			filter:    S{"progress": float64(50)},
+			target:    S{"progress": float64(-1)},
+			want:      true,
+		},
+		{
+			name:      "lt, equal",
+			matchType: domain.MatchTypeLessThan,
+			filter:    S{"progress": float64(50)},
+			target:    S{"progress": float64(50)},
+			want:      false,
+		},
+		{
+			name:      "lte, equal",
+			matchType: domain.MatchTypeLessThanOrEqual,
+			filter:    S{"progress": float64(50)},
+			target:    S{"progress": float64(50)},
+			want:      true,
+		},
+		{
+			name:      "not number target",
+			matchType: domain.MatchTypeGreaterThan,
+			filter:    S{"progress": float64(50)},
+			target:    S{"progress": "100"},
+			want:      false,
+		},
+		{
+			name:      "other key",
+			matchType: domain.MatchTypeGreaterThan,
+			filter:    S{"progress": float64(50)},
+			target:    S{"otherKey": float64(100)},
+			want:      false,
+		},
+		{
+			name:      "nest filter, nest target",
+			matchType: domain.MatchTypeGreaterThanOrEqual,
+			filter:    S{"params": S{"progress": float64(50)}},
+			target:    S{"params": S{"progress": float64(80), "otherKey": "value"}},
+			want:      true,
+		},
+		{
+			name:      "nest filter, no nest target",
+			matchType: domain.MatchTypeGreaterThanOrEqual,
+			filter:    S{"params": S{"progress": float64(50)}},
+			target:    S{"params": float64(80)},
+			want:      false,
+		},
+		{
+			name:      "between, min",
+			matchType: domain.MatchTypeBetween,
+			filter:    S{"severity": A{float64(2), float64(4)}},
+			target:    S{"severity": float64(2)},
+			want:      true,
+		},
+		{
+			name:      "between, max",
+			matchType: domain.MatchTypeBetween,
+			filter:    S{"severity": A{float64(2), float64(4)}},
+			target:    S{"severity": float64(4)},
+			want:      true,
+		},
+		{
+			name:      "between, out of range",
+			matchType: domain.MatchTypeBetween,
+			filter:    S{"severity": A{float64(2), float64(4)}},
+			target:    S{"severity": float64(5)},
+			want:      false,
+		},
+		{
+			name:      "in, number",
+			matchType: domain.MatchTypeIn,
+			filter:    S{"severity": A{float64(1), float64(3)}},
+			target:    S{"severity": float64(3)},
+			want:      true,
+		},
+		{
+			name:      "in, json number",
+			matchType: domain.MatchTypeIn,
+			filter:    S{"severity": A{json.Number("3.0")}},
+			target:    S{"severity": float64(3)},
+			want:      true,
+		},
+		{
+			name:      "in, string",
+			matchType: domain.MatchTypeIn,
+			filter:    S{"level": A{"warn", "error"}},
+			target:    S{"level": "error"},
+			want:      true,
+		},
+		{
+			name:      "in, not contained",
+			matchType: domain.MatchTypeIn,
+			filter:    S{"level": A{"warn", "error"}},
+			target:    S{"level": "info"},
+			want:      false,
+		},
+		{
+			name:      "in, number string",
+			matchType: domain.MatchTypeIn,
+			filter:    S{"severity": A{float64(1)}},
+			target:    S{"severity": "1"},
+			want:      false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := FilterImpl{
+				MatchType: test.matchType,
+				Map:       test.filter,
+			}
+
+			got, err := f.Match(test.target)
+			if err != nil {
+				t.Fatalf("should not be error: %v", err)
+			}
+
+			if got != test.want {
+				t.Errorf("want %v, but %v:", test.want, got)
+			}
+		})
+	}
+
+	t.Run("path", func(t *testing.T) {
+		factory := &FilterClauseFactoryImpl{}
+		filterClause, err := factory.FilterClause(`{"filters": [{"type": "between", "paths": {"items[*].severity": [2, 4]}}]}`)
+		if err != nil {
+			t.Fatalf("should not be error: %v", err)
+		}
+		message := &mock.FakeMessage{
+			FakeUnmarshaled: func() []map[string]interface{} {
+				return []S{{"items": A{S{"severity": float64(1)}, S{"severity": float64(3)}}}}
+			},
+		}
+
+		got, err := filterClause.Match(message)
+		if err != nil {
+			t.Fatalf("should not be error: %v", err)
+		}
+		if !got {
+			t.Errorf("should match if one of the elements is in range")
+		}
+	})
+}
+
+func TestNestedMatch(t *testing.T) {
+	type S = map[string]interface{}
+
+	contained := func(m S) FilterImpl {
+		return FilterImpl{MatchType: domain.MatchTypeContained, Map: m}
+	}
+
+	// (a AND b) OR (c AND NOT d)
+	filterClause := &FilterClauseImpl{
+		OperatorType: domain.OperatorTypeOr,
+		Clauses: []FilterClauseImpl{
+			{
+				OperatorType: domain.OperatorTypeAnd,
+				Filters:      []FilterImpl{contained(S{"a": true}), contained(S{"b": true})},
+			},
+			{
+				OperatorType: domain.OperatorTypeAnd,
+				Filters:      []FilterImpl{contained(S{"c": true})},
+				Clauses: []FilterClauseImpl{
+					{
+						Not:     true,
+						Filters: []FilterImpl{contained(S{"d": true})},
+					},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		filterClause domain.FilterClause
+		targets      []map[string]interface{}
+		want         bool
+	}{
+		{
+			name:         "a and b",
+			filterClause: filterClause,
+			targets:      []S{{"a": true, "b": true}},
+			want:         true,
+		},
+		{
+			name:         "only a",
+			filterClause: filterClause,
+			targets:      []S{{"a": true}},
+			want:         false,
+		},
+		{
+			name:         "c and not d",
+			filterClause: filterClause,
+			targets:      []S{{"c": true}},
+			want:         true,
+		},
+		{
+			name:         "c and d",
+			filterClause: filterClause,
+			targets:      []S{{"c": true, "d": true}},
+			want:         false,
+		},
+		{
+			name: "filters and clauses with and",
+			filterClause: &FilterClauseImpl{
+				OperatorType: domain.OperatorTypeAnd,
+				Filters:      []FilterImpl{contained(S{"a": true})},
+				Clauses: []FilterClauseImpl{
+					{Filters: []FilterImpl{contained(S{"b": true})}},
+				},
+			},
+			targets: []S{{"a": true}},
+			want:    false,
+		},
+		{
+			name: "filters and clauses with or",
+			filterClause: &FilterClauseImpl{
+				OperatorType: domain.OperatorTypeOr,
+				Filters:      []FilterImpl{contained(S{"a": true})},
+				Clauses: []FilterClauseImpl{
+					{Filters: []FilterImpl{contained(S{"b": true})}},
+				},
+			},
+			targets: []S{{"b": true}},
+			want:    true,
+		},
+		{
+			name: "not at top level",
+			filterClause: &FilterClauseImpl{
+				Not: true,
+				Clauses: []FilterClauseImpl{
+					{Filters: []FilterImpl{contained(S{"a": true})}},
+				},
+			},
+			targets: []S{{"a": true}},
+			want:    false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message := &mock.FakeMessage{
+				FakeUnmarshaled: func() []map[string]interface{} {
+					return test.targets
+				},
+			}
+
+			got, err := test.filterClause.Match(message)
+			if err != nil {
+				t.Fatalf("should not be error: %v", err)
+			}
+
+			if got != test.want {
+				t.Errorf("want %v, but %v:", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package impl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/notomo/wsxhub/internal/domain"
+)
+
+// LogLevel :
+type LogLevel int
+
+const (
+	// LogLevelDebug : logs each message and connection
+	LogLevelDebug LogLevel = iota
+	// LogLevelInfo :
+	LogLevelInfo
+	// LogLevelWarn :
+	LogLevelWarn
+	// LogLevelError :
+	LogLevelError
+)
+
+var logLevelNames = map[LogLevel]string{
+	LogLevelDebug: "debug",
+	LogLevelInfo:  "info",
+	LogLevelWarn:  "warn",
+	LogLevelError: "error",
+}
+
+func (level LogLevel) String() string {
+	return logLevelNames[level]
+}
+
+// ParseLogLevel :
+func ParseLogLevel(value string) (LogLevel, error) {
+	for level, name := range logLevelNames {
+		if name == value {
+			return level, nil
+		}
+	}
+	return LogLevelInfo, fmt.Errorf("invalid log level: %s", value)
+}
+
+// LogFormat :
+type LogFormat string
+
+var (
+	// LogFormatText : `2006/01/02 15:04:05 INFO (inside) joined connection=...` for reading
+	LogFormatText = LogFormat("text")
+	// LogFormatJSON : a json object per line for shipping
+	LogFormatJSON = LogFormat("json")
+	// LogFormatLogfmt : `time=... level=info msg=joined worker=inside connection=...`
+	LogFormatLogfmt = LogFormat("logfmt")
+)
+
+// ParseLogFormat :
+func ParseLogFormat(value string) (LogFormat, error) {
+	for _, format := range []LogFormat{LogFormatText, LogFormatJSON, LogFormatLogfmt} {
+		if value == string(format) {
+			return format, nil
+		}
+	}
+	return LogFormatText, fmt.Errorf("invalid log format: %s", value)
+}
+
+const (
+	logTimeLayout = "2006/01/02 15:04:05"
+	// workerLogKey : shown as `(inside)` prefix in the text format
+	workerLogKey = "worker"
+)
+
+// LoggerImpl :
+type LoggerImpl struct {
+	Level  LogLevel
+	Format LogFormat
+	// Writer : uses the standard logger if nil
+	Writer io.Writer
+
+	fields []interface{}
+	mutex  *sync.Mutex
+	now    func() time.Time
+}
+
+// NewLogger :
+func NewLogger(writer io.Writer, level LogLevel, format LogFormat) *LoggerImpl {
+	return &LoggerImpl{
+		Level:  level,
+		Format: format,
+		Writer: writer,
+		mutex:  &sync.Mutex{},
+		now:    time.Now,
+	}
+}
+
+// defaultLogger : used by the components without the logger
+var defaultLogger domain.Logger = NewLogger(nil, LogLevelInfo, LogFormatText)
+
+func loggerOrDefault(logger domain.Logger) domain.Logger {
+	if logger == nil {
+		return defaultLogger
+	}
+	return logger
+}
+
+// Debug :
+func (logger *LoggerImpl) Debug(msg string, keyValues ...interface{}) {
+	logger.write(LogLevelDebug, msg, keyValues)
+}
+
+// Info :
+func (logger *LoggerImpl) Info(msg string, keyValues ...interface{}) {
+	logger.write(LogLevelInfo, msg, keyValues)
+}
+
+// Warn :
+func (logger *LoggerImpl) Warn(msg string, keyValues ...interface{}) {
+	logger.write(LogLevelWarn, msg, keyValues)
+}
+
+// Error :
+func (logger *LoggerImpl) Error(msg string, keyValues ...interface{}) {
+	logger.write(LogLevelError, msg, keyValues)
+}
+
+// With : returns the logger that adds the fields to each log
+func (logger *LoggerImpl) With(keyValues ...interface{}) domain.Logger {
+	child := *logger
+	child.fields = append(append([]interface{}{}, logger.fields...), keyValues...)
+	return &child
+}
+
+func (logger *LoggerImpl) write(level LogLevel, msg string, keyValues []interface{}) {
+	if level < logger.Level {
+		return
+	}
+
+	fields := newLogFields(append(append([]interface{}{}, logger.fields...), keyValues...))
+	now := logger.now()
+
+	var line string
+	switch logger.Format {
+	case LogFormatJSON:
+		line = formatJSONLog(now, level, msg, fields)
+	case LogFormatLogfmt:
+		line = formatLogfmt(now, level, msg, fields)
+	default:
+		line = formatTextLog(level, msg, fields)
+		if logger.Writer != nil {
+			line = now.Format(logTimeLayout) + " " + line
+		}
+	}
+
+	if logger.Writer == nil {
+		log.Print(line)
+		return
+	}
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+	io.WriteString(logger.Writer, line+"\n")
+}
+
+type logField struct {
+	key   string
+	value interface{}
+}
+
+func newLogFields(keyValues []interface{}) []logField {
+	fields := []logField{}
+	for i := 0; i < len(keyValues); i += 2 {
+		key := fmt.Sprint(keyValues[i])
+		var value interface{}
+		if i+1 < len(keyValues) {
+			value = keyValues[i+1]
+		}
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		fields = append(fields, logField{key: key, value: value})
+	}
+	return fields
+}
+
+func formatTextLog(level LogLevel, msg string, fields []logField) string {
+	parts := []string{strings.ToUpper(level.String())}
+	rest := []string{}
+	for _, field := range fields {
+		if field.key == workerLogKey {
+			parts = append(parts, fmt.Sprintf("(%v)", field.value))
+			continue
+		}
+		rest = append(rest, field.key+"="+logfmtValue(field.value))
+	}
+	parts = append(parts, msg)
+	return strings.Join(append(parts, rest...), " ")
+}
+
+func formatLogfmt(now time.Time, level LogLevel, msg string, fields []logField) string {
+	parts := []string{
+		"time=" + now.Format(time.RFC3339Nano),
+		"level=" + level.String(),
+		"msg=" + logfmtValue(msg),
+	}
+	for _, field := range fields {
+		parts = append(parts, field.key+"="+logfmtValue(field.value))
+	}
+	return strings.Join(parts, " ")
+}
+
+func logfmtValue(value interface{}) string {
+	s := fmt.Sprint(value)
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func formatJSONLog(now time.Time, level LogLevel, msg string, fields []logField) string {
+	fields = append([]logField{
+		{key: "time", value: now.Format(time.RFC3339Nano)},
+		{key: "level", value: level.String()},
+		{key: "msg", value: msg},
+	}, fields...)
+
+	buffer := &bytes.Buffer{}
+	buffer.WriteString("{")
+	for i, field := range fields {
+		if i > 0 {
+			buffer.WriteString(",")
+		}
+		key, _ := json.Marshal(field.key)
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			value, _ = json.Marshal(fmt.Sprint(field.value))
+		}
+		buffer.Write(key)
+		buffer.WriteString(":")
+		buffer.Write(value)
+	}
+	buffer.WriteString("}")
+	return buffer.String()
+}
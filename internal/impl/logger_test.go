@@ -0,0 +1,112 @@
+package impl
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLogger(t *testing.T) {
+	now := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		level  LogLevel
+		format LogFormat
+		log    func(*LoggerImpl)
+		want   string
+	}{
+		{
+			name:   "text",
+			level:  LogLevelInfo,
+			format: LogFormatText,
+			log: func(logger *LoggerImpl) {
+				logger.With("worker", "inside").Info("joined", "connection", "1", "remote", "127.0.0.1:1234", "count", 1)
+			},
+			want: "2019/01/02 03:04:05 INFO (inside) joined connection=1 remote=127.0.0.1:1234 count=1\n",
+		},
+		{
+			name:   "logfmt",
+			level:  LogLevelInfo,
+			format: LogFormatLogfmt,
+			log: func(logger *LoggerImpl) {
+				logger.With("worker", "inside").Warn("failed to send", "error", fmt.Errorf("broken pipe"), "changes", "")
+			},
+			want: `time=2019-01-02T03:04:05Z level=warn msg="failed to send" worker=inside error="broken pipe" changes=""` + "\n",
+		},
+		{
+			name:   "json",
+			level:  LogLevelDebug,
+			format: LogFormatJSON,
+			log: func(logger *LoggerImpl) {
+				logger.With("worker", "outside").Debug("sent", "connection", "1", "size", 12)
+			},
+			want: `{"time":"2019-01-02T03:04:05Z","level":"debug","msg":"sent","worker":"outside","connection":"1","size":12}` + "\n",
+		},
+		{
+			name:   "filtered by level",
+			level:  LogLevelWarn,
+			format: LogFormatText,
+			log: func(logger *LoggerImpl) {
+				logger.Debug("sent")
+				logger.Info("joined")
+			},
+			want: "",
+		},
+		{
+			name:   "odd key values",
+			level:  LogLevelInfo,
+			format: LogFormatLogfmt,
+			log: func(logger *LoggerImpl) {
+				logger.Error("closed", "count")
+			},
+			want: "time=2019-01-02T03:04:05Z level=error msg=closed count=<nil>\n",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			writer := &bytes.Buffer{}
+			logger := NewLogger(writer, test.level, test.format)
+			logger.now = func() time.Time {
+				return now
+			}
+
+			test.log(logger)
+
+			if got := writer.String(); got != test.want {
+				t.Errorf("want %v, but %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	level, err := ParseLogLevel("warn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := level, LogLevelWarn; got != want {
+		t.Errorf("want %v, but %v", want, got)
+	}
+
+	if _, err := ParseLogLevel("verbose"); err == nil {
+		t.Error("should be error")
+	}
+}
+
+func TestParseLogFormat(t *testing.T) {
+	format, err := ParseLogFormat("logfmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := format, LogFormatLogfmt; got != want {
+		t.Errorf("want %v, but %v", want, got)
+	}
+
+	if _, err := ParseLogFormat("yaml"); err == nil {
+		t.Error("should be error")
+	}
+}
@@ -6,18 +6,52 @@ import (
 	"io"
 	"io/ioutil"
 
+	"github.com/gorilla/websocket"
 	"github.com/notomo/wsxhub/internal/domain"
 )
 
 // MessageFactoryImpl :
+// MaxDepth and MaxBatchLength are not limited if 0.
 type MessageFactoryImpl struct {
+	MaxDepth       int
+	MaxBatchLength int
 }
 
-// FromBytes :
+// MessageError : the rejected message and the websocket close code for the sender
+type MessageError struct {
+	Code   int
+	Reason string
+}
+
+func (err *MessageError) Error() string {
+	return err.Reason
+}
+
+func invalidMessage(format string, args ...interface{}) *MessageError {
+	return &MessageError{
+		Code:   websocket.CloseInvalidFramePayloadData,
+		Reason: fmt.Sprintf(format, args...),
+	}
+}
+
+func policyViolation(format string, args ...interface{}) *MessageError {
+	return &MessageError{
+		Code:   websocket.ClosePolicyViolation,
+		Reason: fmt.Sprintf(format, args...),
+	}
+}
+
+// FromBytes : rejects the message nested deeper than MaxDepth before decoding
 func (factory *MessageFactoryImpl) FromBytes(bytes []byte) (domain.Message, error) {
+	if factory.MaxDepth > 0 {
+		if depth := jsonDepth(bytes); depth > factory.MaxDepth {
+			return nil, policyViolation("message depth %d exceeds the limit %d", depth, factory.MaxDepth)
+		}
+	}
+
 	var unknown interface{}
 	if err := json.Unmarshal(bytes, &unknown); err != nil {
-		return nil, err
+		return nil, invalidMessage("invalid json: %s", err)
 	}
 
 	if m, ok := unknown.(map[string]interface{}); ok {
@@ -29,14 +63,17 @@ func (factory *MessageFactoryImpl) FromBytes(bytes []byte) (domain.Message, erro
 
 	unknowns, ok := unknown.([]interface{})
 	if !ok {
-		return nil, fmt.Errorf("message must be map or map[]")
+		return nil, invalidMessage("message must be map or map[]")
+	}
+	if factory.MaxBatchLength > 0 && len(unknowns) > factory.MaxBatchLength {
+		return nil, policyViolation("batch length %d exceeds the limit %d", len(unknowns), factory.MaxBatchLength)
 	}
 
 	maps := []map[string]interface{}{}
 	for _, u := range unknowns {
 		m, ok := u.(map[string]interface{})
 		if !ok {
-			return nil, fmt.Errorf("message must be map or map[]")
+			return nil, invalidMessage("message must be map or map[]")
 		}
 		maps = append(maps, m)
 	}
@@ -44,9 +81,66 @@ func (factory *MessageFactoryImpl) FromBytes(bytes []byte) (domain.Message, erro
 	return &MessageImpl{
 		bytes:       bytes,
 		unmarshaled: maps,
+		batch:       true,
 	}, nil
 }
 
+// jsonDepth : returns the max nesting depth of the objects and the arrays without decoding
+func jsonDepth(bytes []byte) int {
+	depth := 0
+	max := 0
+	inString := false
+	escaped := false
+	for _, b := range bytes {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case b == '\\':
+				escaped = true
+			case b == '"':
+				inString = false
+			}
+			continue
+		}
+		switch b {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+			if depth > max {
+				max = depth
+			}
+		case '}', ']':
+			depth--
+		}
+	}
+	return max
+}
+
+// FromStream : calls the callback with each message or the error of the invalid value in the stream,
+// and stops on the error returned by the callback
+func (factory *MessageFactoryImpl) FromStream(inputReader io.Reader, callback func(domain.Message, error) error) error {
+	scanner := newJSONScanner(inputReader)
+	for {
+		value, line, err := scanner.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		message, err := factory.FromBytes(value)
+		if err != nil {
+			err = fmt.Errorf("line %d: %s", line, err)
+		}
+		if err := callback(message, err); err != nil {
+			return err
+		}
+	}
+}
+
 // FromReader :
 func (factory *MessageFactoryImpl) FromReader(inputReader io.Reader) (domain.Message, error) {
 	bytes, err := ioutil.ReadAll(inputReader)
@@ -60,6 +154,7 @@ func (factory *MessageFactoryImpl) FromReader(inputReader io.Reader) (domain.Mes
 type MessageImpl struct {
 	bytes       []byte
 	unmarshaled []map[string]interface{}
+	batch       bool
 }
 
 // Bytes :
@@ -71,3 +166,73 @@ func (msg *MessageImpl) Bytes() []byte {
 func (msg *MessageImpl) Unmarshaled() []map[string]interface{} {
 	return msg.unmarshaled
 }
+
+// Batch : returns true if the message is an array of maps
+func (msg *MessageImpl) Batch() bool {
+	return msg.batch
+}
+
+// ReplaceField : returns a copy of the message that has the field replaced in every map.
+// The function receives the value and whether the map has the field,
+// and returns the new value and whether to keep the field.
+func (msg *MessageImpl) ReplaceField(key string, replace func(interface{}, bool) (interface{}, bool)) (domain.Message, error) {
+	maps := []map[string]interface{}{}
+	for _, m := range msg.unmarshaled {
+		copied := map[string]interface{}{}
+		for k, v := range m {
+			copied[k] = v
+		}
+		value, ok := m[key]
+		if value, ok := replace(value, ok); ok {
+			copied[key] = value
+		} else {
+			delete(copied, key)
+		}
+		maps = append(maps, copied)
+	}
+
+	var unknown interface{} = maps
+	if !msg.batch {
+		unknown = maps[0]
+	}
+	bytes, err := json.Marshal(unknown)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MessageImpl{
+		bytes:       bytes,
+		unmarshaled: maps,
+		batch:       msg.batch,
+	}, nil
+}
+
+// Subset : returns the message that has only the maps at the indexes
+// A batch message is still a batch even if it has one map.
+func (msg *MessageImpl) Subset(indexes []int) (domain.Message, error) {
+	maps := []map[string]interface{}{}
+	for _, index := range indexes {
+		if index < 0 || index >= len(msg.unmarshaled) {
+			return nil, fmt.Errorf("out of range: %d", index)
+		}
+		maps = append(maps, msg.unmarshaled[index])
+	}
+	if len(maps) == 0 {
+		return nil, fmt.Errorf("empty subset")
+	}
+
+	var unknown interface{} = maps
+	if !msg.batch {
+		unknown = maps[0]
+	}
+	bytes, err := json.Marshal(unknown)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MessageImpl{
+		bytes:       bytes,
+		unmarshaled: maps,
+		batch:       msg.batch,
+	}, nil
+}
@@ -3,6 +3,8 @@ package impl
 import (
 	"bytes"
 	"testing"
+
+	"github.com/gorilla/websocket"
 )
 
 func TestFromReader(t *testing.T) {
@@ -30,3 +32,188 @@ func TestFromReader(t *testing.T) {
 		}
 	}
 }
+
+func TestReplaceField(t *testing.T) {
+	tests := []struct {
+		name       string
+		rawMessage string
+		replace    func(interface{}, bool) (interface{}, bool)
+		want       string
+	}{
+		{
+			name:       "map",
+			rawMessage: `{"id":"1"}`,
+			replace: func(value interface{}, ok bool) (interface{}, bool) {
+				return "stamped", true
+			},
+			want: `{"id":"stamped"}`,
+		},
+		{
+			name:       "batch",
+			rawMessage: `[{"id":"1"},{"key":"value"}]`,
+			replace: func(value interface{}, ok bool) (interface{}, bool) {
+				return "stamped", true
+			},
+			want: `[{"id":"stamped"},{"id":"stamped","key":"value"}]`,
+		},
+		{
+			name:       "restore",
+			rawMessage: `[{"id":"stamped1"},{"id":"stamped2","key":"value"},{"id":"other"}]`,
+			replace: func(value interface{}, ok bool) (interface{}, bool) {
+				switch value {
+				case "stamped1":
+					return 1.0, true
+				case "stamped2":
+					return nil, false
+				}
+				return value, ok
+			},
+			want: `[{"id":1},{"key":"value"},{"id":"other"}]`,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			factory := MessageFactoryImpl{}
+			message, err := factory.FromBytes([]byte(test.rawMessage))
+			if err != nil {
+				t.Fatalf("should not be error: %v", err)
+			}
+
+			replaced, err := message.ReplaceField("id", test.replace)
+			if err != nil {
+				t.Fatalf("should not be error: %v", err)
+			}
+
+			if got := string(replaced.Bytes()); got != test.want {
+				t.Errorf("want %v, but %v:", test.want, got)
+			}
+			if got := string(message.Bytes()); got != test.rawMessage {
+				t.Errorf("should not change the original message, but %v:", got)
+			}
+		})
+	}
+}
+
+func TestSubset(t *testing.T) {
+	tests := []struct {
+		name       string
+		rawMessage string
+		indexes    []int
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "batch",
+			rawMessage: `[{"id":"1"},{"id":"2"},{"id":"3"}]`,
+			indexes:    []int{0, 2},
+			want:       `[{"id":"1"},{"id":"3"}]`,
+		},
+		{
+			name:       "one map in batch",
+			rawMessage: `[{"id":"1"},{"id":"2"}]`,
+			indexes:    []int{1},
+			want:       `[{"id":"2"}]`,
+		},
+		{
+			name:       "map",
+			rawMessage: `{"id":"1"}`,
+			indexes:    []int{0},
+			want:       `{"id":"1"}`,
+		},
+		{
+			name:       "out of range",
+			rawMessage: `{"id":"1"}`,
+			indexes:    []int{1},
+			wantErr:    true,
+		},
+		{
+			name:       "empty",
+			rawMessage: `[{"id":"1"}]`,
+			indexes:    []int{},
+			wantErr:    true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			factory := MessageFactoryImpl{}
+			message, err := factory.FromBytes([]byte(test.rawMessage))
+			if err != nil {
+				t.Fatalf("should not be error: %v", err)
+			}
+
+			subset, err := message.Subset(test.indexes)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("should be error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("should not be error: %v", err)
+			}
+
+			if got := string(subset.Bytes()); got != test.want {
+				t.Errorf("want %v, but %v:", test.want, got)
+			}
+		})
+	}
+}
+
+func TestFromBytesLimits(t *testing.T) {
+	tests := []struct {
+		name       string
+		rawMessage string
+		wantCode   int
+	}{
+		{
+			name:       "within limits",
+			rawMessage: `[{"a":{"b":"{{{{"}},{"c":[]}]`,
+		},
+		{
+			name:       "too deep",
+			rawMessage: `{"a":{"b":{"c":[]}}}`,
+			wantCode:   websocket.ClosePolicyViolation,
+		},
+		{
+			name:       "too long batch",
+			rawMessage: `[{},{},{}]`,
+			wantCode:   websocket.ClosePolicyViolation,
+		},
+		{
+			name:       "invalid json",
+			rawMessage: `{"a":`,
+			wantCode:   websocket.CloseInvalidFramePayloadData,
+		},
+		{
+			name:       "not map",
+			rawMessage: `[1]`,
+			wantCode:   websocket.CloseInvalidFramePayloadData,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			factory := MessageFactoryImpl{MaxDepth: 3, MaxBatchLength: 2}
+			_, err := factory.FromBytes([]byte(test.rawMessage))
+			if test.wantCode == 0 {
+				if err != nil {
+					t.Fatalf("should not be error: %v", err)
+				}
+				return
+			}
+
+			messageErr, ok := err.(*MessageError)
+			if !ok {
+				t.Fatalf("should be MessageError, but %v", err)
+			}
+			if got := messageErr.Code; got != test.wantCode {
+				t.Errorf("want %v, but %v:", test.wantCode, got)
+			}
+		})
+	}
+}
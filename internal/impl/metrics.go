@@ -0,0 +1,209 @@
+package impl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	metricReceived       = "wsxhub_messages_received_total"
+	metricDelivered      = "wsxhub_messages_delivered_total"
+	metricFilteredOut    = "wsxhub_messages_filtered_out_total"
+	metricDebounced      = "wsxhub_messages_debounced_total"
+	metricDropped        = "wsxhub_messages_dropped_total"
+	metricSendErrors     = "wsxhub_send_errors_total"
+	metricJoined         = "wsxhub_connections_joined_total"
+	metricLeft           = "wsxhub_connections_left_total"
+	metricFilterDuration = "wsxhub_filter_duration_seconds"
+	metricWriteDuration  = "wsxhub_write_duration_seconds"
+)
+
+// Metrics : counters and histograms exposed in the prometheus text format.
+// The nil Metrics records nothing.
+type Metrics struct {
+	counters   []*counterVec
+	histograms []*histogramVec
+}
+
+// NewMetrics :
+func NewMetrics() *Metrics {
+	return &Metrics{
+		counters: []*counterVec{
+			newCounterVec(metricReceived, "Messages received by the worker.", "worker"),
+			newCounterVec(metricDelivered, "Messages written to the connections.", "side"),
+			newCounterVec(metricFilteredOut, "Messages not matched with the filter of the connections.", "side"),
+			newCounterVec(metricDebounced, "Messages deferred by the debounce of the connections.", "side"),
+			newCounterVec(metricDropped, "Messages dropped by the full send queue of the connections.", "side"),
+			newCounterVec(metricSendErrors, "Errors on writing to the connections.", "side"),
+			newCounterVec(metricJoined, "Connections joined.", "side"),
+			newCounterVec(metricLeft, "Connections left.", "side"),
+		},
+		histograms: []*histogramVec{
+			newHistogramVec(metricFilterDuration, "Time to evaluate the filter of the connections.", "side",
+				[]float64{0.00001, 0.00005, 0.0001, 0.0005, 0.001, 0.005, 0.01}),
+			newHistogramVec(metricWriteDuration, "Time to write a message to the websocket.", "side",
+				[]float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1}),
+		},
+	}
+}
+
+func (metrics *Metrics) count(name string, label string) {
+	if metrics == nil {
+		return
+	}
+	for _, counter := range metrics.counters {
+		if counter.name == name {
+			counter.inc(label)
+			return
+		}
+	}
+}
+
+func (metrics *Metrics) observe(name string, label string, started time.Time) {
+	if metrics == nil {
+		return
+	}
+	for _, histogram := range metrics.histograms {
+		if histogram.name == name {
+			histogram.observe(label, time.Since(started).Seconds())
+			return
+		}
+	}
+}
+
+// Write : writes all the metrics in the prometheus text format
+func (metrics *Metrics) Write(w io.Writer) error {
+	buffered := bufio.NewWriter(w)
+	for _, counter := range metrics.counters {
+		counter.write(buffered)
+	}
+	for _, histogram := range metrics.histograms {
+		histogram.write(buffered)
+	}
+	return buffered.Flush()
+}
+
+type counterVec struct {
+	name   string
+	help   string
+	label  string
+	mutex  sync.Mutex
+	values map[string]float64
+}
+
+func newCounterVec(name string, help string, label string) *counterVec {
+	return &counterVec{
+		name:   name,
+		help:   help,
+		label:  label,
+		values: make(map[string]float64),
+	}
+}
+
+func (counter *counterVec) inc(label string) {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	counter.values[label]++
+}
+
+func (counter *counterVec) write(w io.Writer) {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", counter.name, counter.help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", counter.name)
+	for _, label := range sortedKeys(counter.values) {
+		fmt.Fprintf(w, "%s{%s} %s\n", counter.name, labelPair(counter.label, label), formatFloat(counter.values[label]))
+	}
+}
+
+type histogramVec struct {
+	name    string
+	help    string
+	label   string
+	buckets []float64
+	mutex   sync.Mutex
+	values  map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogramVec(name string, help string, label string, buckets []float64) *histogramVec {
+	return &histogramVec{
+		name:    name,
+		help:    help,
+		label:   label,
+		buckets: buckets,
+		values:  make(map[string]*histogram),
+	}
+}
+
+func (vec *histogramVec) observe(label string, value float64) {
+	vec.mutex.Lock()
+	defer vec.mutex.Unlock()
+
+	h, ok := vec.values[label]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(vec.buckets))}
+		vec.values[label] = h
+	}
+	for i, bound := range vec.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+func (vec *histogramVec) write(w io.Writer) {
+	vec.mutex.Lock()
+	defer vec.mutex.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", vec.name, vec.help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", vec.name)
+	labels := []string{}
+	for label := range vec.values {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		h := vec.values[label]
+		pair := labelPair(vec.label, label)
+		for i, bound := range vec.buckets {
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", vec.name, pair, formatFloat(bound), h.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", vec.name, pair, h.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", vec.name, pair, formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", vec.name, pair, h.count)
+	}
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func labelPair(name string, value string) string {
+	return fmt.Sprintf(`%s="%s"`, name, labelValueReplacer.Replace(value))
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys(values map[string]float64) []string {
+	keys := []string{}
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,70 @@
+package impl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsWrite(t *testing.T) {
+	metrics := &Metrics{
+		counters: []*counterVec{
+			newCounterVec("test_total", "Test counter.", "side"),
+		},
+		histograms: []*histogramVec{
+			newHistogramVec("test_seconds", "Test histogram.", "side", []float64{0.5, 1}),
+		},
+	}
+	metrics.count("test_total", "outside")
+	metrics.count("test_total", "inside")
+	metrics.count("test_total", "inside")
+	metrics.count("notFound", "inside")
+	metrics.histograms[0].observe(`a"b`, 0.25)
+	metrics.histograms[0].observe(`a"b`, 0.75)
+	metrics.histograms[0].observe(`a"b`, 2)
+
+	writer := &bytes.Buffer{}
+	if err := metrics.Write(writer); err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.Join([]string{
+		`# HELP test_total Test counter.`,
+		`# TYPE test_total counter`,
+		`test_total{side="inside"} 2`,
+		`test_total{side="outside"} 1`,
+		`# HELP test_seconds Test histogram.`,
+		`# TYPE test_seconds histogram`,
+		`test_seconds_bucket{side="a\"b",le="0.5"} 1`,
+		`test_seconds_bucket{side="a\"b",le="1"} 2`,
+		`test_seconds_bucket{side="a\"b",le="+Inf"} 3`,
+		`test_seconds_sum{side="a\"b"} 3`,
+		`test_seconds_count{side="a\"b"} 3`,
+		``,
+	}, "\n")
+	if got := writer.String(); got != want {
+		t.Errorf("want %v, but %v", want, got)
+	}
+}
+
+func TestNilMetrics(t *testing.T) {
+	var metrics *Metrics
+
+	metrics.count(metricReceived, "inside")
+	metrics.observe(metricWriteDuration, "inside", time.Now())
+}
+
+func TestMetricsObserve(t *testing.T) {
+	metrics := NewMetrics()
+
+	metrics.observe(metricFilterDuration, "inside", time.Now())
+
+	writer := &bytes.Buffer{}
+	if err := metrics.Write(writer); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := writer.String(), `wsxhub_filter_duration_seconds_count{side="inside"} 1`; !strings.Contains(got, want) {
+		t.Errorf("should contain %s, but %s", want, got)
+	}
+}
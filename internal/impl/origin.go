@@ -0,0 +1,51 @@
+package impl
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// originPatterns : allowlist of origins like `https://example.com`, `https://*.example.com` or `chrome-extension://*`
+type originPatterns []string
+
+func newOriginPatterns(sources []string) (originPatterns, error) {
+	patterns := originPatterns{}
+	for _, source := range sources {
+		pattern := strings.ToLower(source)
+		if !strings.Contains(pattern, "://") {
+			return nil, fmt.Errorf("origin pattern must have a scheme: %s", source)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid origin pattern: %s", source)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// Allowed : allows only the browser extensions if no pattern is given
+// not to be connected by any web page the user visits.
+// The request without Origin header is allowed because it is not from browsers.
+func (patterns originPatterns) Allowed(origin string) bool {
+	if origin == "" {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	if len(patterns) == 0 {
+		return isExtensionOrigin(origin)
+	}
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, origin); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// isExtensionOrigin : `chrome-extension://...`, `moz-extension://...` or `safari-web-extension://...`
+func isExtensionOrigin(origin string) bool {
+	index := strings.Index(origin, "://")
+	return index > 0 && strings.HasSuffix(origin[:index], "-extension")
+}
@@ -0,0 +1,132 @@
+package impl
+
+import (
+	"testing"
+)
+
+func TestOriginAllowed(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		origin   string
+		want     bool
+	}{
+		{
+			name:     "web page without patterns",
+			patterns: []string{},
+			origin:   "https://evil.example.com",
+			want:     false,
+		},
+		{
+			name:     "null origin without patterns",
+			patterns: []string{},
+			origin:   "null",
+			want:     false,
+		},
+		{
+			name:     "extension without patterns",
+			patterns: []string{},
+			origin:   "chrome-extension://abcdefghijklmnop",
+			want:     true,
+		},
+		{
+			name:     "no origin without patterns",
+			patterns: []string{},
+			origin:   "",
+			want:     true,
+		},
+		{
+			name:     "no origin",
+			patterns: []string{"https://example.com"},
+			origin:   "",
+			want:     true,
+		},
+		{
+			name:     "exact",
+			patterns: []string{"https://example.com"},
+			origin:   "https://example.com",
+			want:     true,
+		},
+		{
+			name:     "case insensitive",
+			patterns: []string{"https://Example.com"},
+			origin:   "HTTPS://example.COM",
+			want:     true,
+		},
+		{
+			name:     "other port",
+			patterns: []string{"https://example.com"},
+			origin:   "https://example.com:8443",
+			want:     false,
+		},
+		{
+			name:     "glob",
+			patterns: []string{"https://*.example.com"},
+			origin:   "https://app.example.com",
+			want:     true,
+		},
+		{
+			name:     "glob does not match the suffix",
+			patterns: []string{"https://*.example.com"},
+			origin:   "https://example.com.evil.test",
+			want:     false,
+		},
+		{
+			name:     "chrome extension",
+			patterns: []string{"chrome-extension://abcdefghijklmnop"},
+			origin:   "chrome-extension://abcdefghijklmnop",
+			want:     true,
+		},
+		{
+			name:     "moz extension glob",
+			patterns: []string{"https://example.com", "moz-extension://*"},
+			origin:   "moz-extension://0a1b2c3d-4e5f",
+			want:     true,
+		},
+		{
+			name:     "other scheme",
+			patterns: []string{"moz-extension://*"},
+			origin:   "chrome-extension://abcdefghijklmnop",
+			want:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patterns, err := newOriginPatterns(tt.patterns)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := patterns.Allowed(tt.origin)
+
+			if got != tt.want {
+				t.Errorf("want %v, but %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestInvalidOriginPattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+	}{
+		{
+			name:    "no scheme",
+			pattern: "example.com",
+		},
+		{
+			name:    "bad pattern",
+			pattern: "https://[example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newOriginPatterns([]string{tt.pattern}); err == nil {
+				t.Errorf("should be error: %s", tt.pattern)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package impl
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// keyPath : parsed path expression like `params.items[0].uri`, `tags[*]` or `params.*.uri`
+type keyPath []pathSegment
+
+type pathSegment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+func parseKeyPath(source string) (keyPath, error) {
+	if source == "" {
+		return nil, errors.New("empty key path")
+	}
+
+	path := keyPath{}
+	for _, part := range strings.Split(source, ".") {
+		bracket := strings.Index(part, "[")
+		name := part
+		if bracket >= 0 {
+			name = part[:bracket]
+		}
+		if name == "" || strings.Contains(name, "]") {
+			return nil, fmt.Errorf("invalid key path: %s", source)
+		}
+		path = append(path, pathSegment{key: name, wildcard: name == "*"})
+
+		rest := ""
+		if bracket >= 0 {
+			rest = part[bracket:]
+		}
+		for rest != "" {
+			end := strings.Index(rest, "]")
+			if !strings.HasPrefix(rest, "[") || end < 0 {
+				return nil, fmt.Errorf("invalid key path: %s", source)
+			}
+			index := rest[1:end]
+			rest = rest[end+1:]
+
+			if index == "*" {
+				path = append(path, pathSegment{isIndex: true, wildcard: true})
+				continue
+			}
+			i, err := strconv.Atoi(index)
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("invalid index in key path: %s", source)
+			}
+			path = append(path, pathSegment{isIndex: true, index: i})
+		}
+	}
+
+	return path, nil
+}
+
+// Lookup : returns all the values addressed by the path
+func (path keyPath) Lookup(value interface{}) []interface{} {
+	values := []interface{}{value}
+	for _, segment := range path {
+		nextValues := []interface{}{}
+		for _, v := range values {
+			nextValues = append(nextValues, segment.lookup(v)...)
+		}
+		values = nextValues
+	}
+	return values
+}
+
+func (segment pathSegment) lookup(value interface{}) []interface{} {
+	if segment.isIndex {
+		array, ok := value.([]interface{})
+		if !ok {
+			return nil
+		}
+		if segment.wildcard {
+			return array
+		}
+		if segment.index >= len(array) {
+			return nil
+		}
+		return []interface{}{array[segment.index]}
+	}
+
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if segment.wildcard {
+		values := []interface{}{}
+		for _, v := range m {
+			values = append(values, v)
+		}
+		return values
+	}
+	v, ok := m[segment.key]
+	if !ok {
+		return nil
+	}
+	return []interface{}{v}
+}
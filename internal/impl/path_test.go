@@ -0,0 +1,123 @@
+package impl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseKeyPath(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   keyPath
+	}{
+		{
+			name:   "key",
+			source: "id",
+			want:   keyPath{{key: "id"}},
+		},
+		{
+			name:   "dotted",
+			source: "params.uri",
+			want:   keyPath{{key: "params"}, {key: "uri"}},
+		},
+		{
+			name:   "index",
+			source: "params.items[0].uri",
+			want:   keyPath{{key: "params"}, {key: "items"}, {isIndex: true, index: 0}, {key: "uri"}},
+		},
+		{
+			name:   "wildcards",
+			source: "params.*.tags[*]",
+			want:   keyPath{{key: "params"}, {key: "*", wildcard: true}, {key: "tags"}, {isIndex: true, wildcard: true}},
+		},
+		{
+			name:   "nested index",
+			source: "matrix[1][2]",
+			want:   keyPath{{key: "matrix"}, {isIndex: true, index: 1}, {isIndex: true, index: 2}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseKeyPath(test.source)
+			if err != nil {
+				t.Fatalf("should not be error: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("want %v, but %v:", test.want, got)
+			}
+		})
+	}
+
+	for _, source := range []string{"", "a..b", "[0]", "a[", "a[x]", "a[-1]", "a]b", "a[0]b"} {
+		t.Run("invalid: "+source, func(t *testing.T) {
+			if _, err := parseKeyPath(source); err == nil {
+				t.Errorf("should be error")
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	type S = map[string]interface{}
+	type A = []interface{}
+
+	target := S{
+		"params": S{
+			"items": A{S{"uri": "a"}, S{"uri": "b"}},
+		},
+		"tags": A{"x", "y"},
+	}
+
+	tests := []struct {
+		name   string
+		source string
+		want   []interface{}
+	}{
+		{
+			name:   "index",
+			source: "params.items[1].uri",
+			want:   A{"b"},
+		},
+		{
+			name:   "index wildcard",
+			source: "params.items[*].uri",
+			want:   A{"a", "b"},
+		},
+		{
+			name:   "key wildcard",
+			source: "*[0]",
+			want:   A{"x"},
+		},
+		{
+			name:   "out of range",
+			source: "tags[2]",
+			want:   A{},
+		},
+		{
+			name:   "not found",
+			source: "params.uri",
+			want:   A{},
+		},
+		{
+			name:   "index of map",
+			source: "params[0]",
+			want:   A{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path, err := parseKeyPath(test.source)
+			if err != nil {
+				t.Fatalf("should not be error: %v", err)
+			}
+
+			if got := path.Lookup(target); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("want %v, but %v:", test.want, got)
+			}
+		})
+	}
+}
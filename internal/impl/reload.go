@@ -0,0 +1,205 @@
+package impl
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/notomo/wsxhub/internal/domain"
+)
+
+const (
+	// InsideTokenEnvName : the environment variable for the inside token used if no token file
+	InsideTokenEnvName = "WSXHUB_INSIDE_TOKEN"
+	// OutsideTokenEnvName : the environment variable for the outside token used if no token file
+	OutsideTokenEnvName = "WSXHUB_OUTSIDE_TOKEN"
+	// AdminTokenEnvName : the environment variable for the admin token used if no token file
+	AdminTokenEnvName = "WSXHUB_ADMIN_TOKEN"
+)
+
+// ConfigReloaderImpl :
+type ConfigReloaderImpl struct {
+	ConfigFactory        *ConfigFactoryImpl
+	Path                 string
+	Override             func(*domain.Config)
+	Config               *domain.Config
+	InsideServerFactory  *ServerFactoryImpl
+	OutsideServerFactory *ServerFactoryImpl
+	Workers              []*WorkerImpl
+	Logger               domain.Logger
+	mutex                sync.Mutex
+}
+
+// Reload : applies the reloadable settings to the new connections and keeps the existing connections.
+// The invalid config is rejected without applying anything.
+func (reloader *ConfigReloaderImpl) Reload() error {
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+
+	config, err := reloader.ConfigFactory.Config(reloader.Path)
+	if err != nil {
+		return err
+	}
+	if reloader.Override != nil {
+		reloader.Override(config)
+	}
+	if err := reloader.ConfigFactory.Validate(config); err != nil {
+		return err
+	}
+
+	restartRequired := keepRestartRequired(reloader.Config, config)
+	changes := configChanges(reloader.Config, config)
+
+	insideSettings, insideChanged, err := reloader.settings(config, config.Inside, reloader.InsideServerFactory, InsideTokenEnvName)
+	if err != nil {
+		return fmt.Errorf("inside: %s", err)
+	}
+	if insideChanged {
+		changes = append(changes, "inside.token")
+	}
+	outsideSettings, outsideChanged, err := reloader.settings(config, config.Outside, reloader.OutsideServerFactory, OutsideTokenEnvName)
+	if err != nil {
+		return fmt.Errorf("outside: %s", err)
+	}
+	if outsideChanged {
+		changes = append(changes, "outside.token")
+	}
+
+	reloader.InsideServerFactory.setSettings(insideSettings)
+	reloader.OutsideServerFactory.setSettings(outsideSettings)
+	if reloader.Config.RetainKey != config.RetainKey {
+		for _, worker := range reloader.Workers {
+			worker.ChangeRetainKey(config.RetainKey)
+		}
+	}
+	reloader.Config = config
+
+	logger := loggerOrDefault(reloader.Logger)
+	logger.Info("reloaded config", "changes", strings.Join(changes, ","))
+	if len(restartRequired) != 0 {
+		logger.Warn("not reloaded config (requires restart)", "keys", strings.Join(restartRequired, ","))
+	}
+
+	return nil
+}
+
+// settings : returns the new settings and whether the token is changed without changing the token file path
+func (reloader *ConfigReloaderImpl) settings(
+	config *domain.Config,
+	listener domain.ListenerConfig,
+	current *ServerFactoryImpl,
+	tokenEnvName string,
+) (*serverSettings, bool, error) {
+	factory, err := NewServerFactory(config, listener, tokenEnvName)
+	if err != nil {
+		return nil, false, err
+	}
+	settings, err := factory.newSettings()
+	if err != nil {
+		return nil, false, err
+	}
+	tokenChanged := settings.token != current.currentSettings().token
+	return settings, tokenChanged, nil
+}
+
+// keepRestartRequired : reverts the settings that can't be changed while serving and returns their keys
+func keepRestartRequired(before *domain.Config, after *domain.Config) []string {
+	keys := []string{}
+	listeners := []struct {
+		name   string
+		before *domain.ListenerConfig
+		after  *domain.ListenerConfig
+	}{
+		{name: "inside", before: &before.Inside, after: &after.Inside},
+		{name: "outside", before: &before.Outside, after: &after.Outside},
+	}
+	for _, l := range listeners {
+		if !equalStrings(l.before.Listen, l.after.Listen) {
+			keys = append(keys, l.name+".listen")
+			l.after.Listen = l.before.Listen
+		}
+		if l.before.TLSCert != l.after.TLSCert {
+			keys = append(keys, l.name+".tlsCert")
+			l.after.TLSCert = l.before.TLSCert
+		}
+		if l.before.TLSKey != l.after.TLSKey {
+			keys = append(keys, l.name+".tlsKey")
+			l.after.TLSKey = l.before.TLSKey
+		}
+	}
+	if !equalStrings(before.Admin.Listen, after.Admin.Listen) {
+		keys = append(keys, "admin.listen")
+		after.Admin.Listen = before.Admin.Listen
+	}
+	if before.Admin.TokenFile != after.Admin.TokenFile {
+		keys = append(keys, "admin.tokenFile")
+		after.Admin.TokenFile = before.Admin.TokenFile
+	}
+	if before.CorrelationKey != after.CorrelationKey {
+		keys = append(keys, "correlationKey")
+		after.CorrelationKey = before.CorrelationKey
+	}
+	if before.MaxMessageSize != after.MaxMessageSize {
+		keys = append(keys, "maxMessageSize")
+		after.MaxMessageSize = before.MaxMessageSize
+	}
+	if before.MaxMessageDepth != after.MaxMessageDepth {
+		keys = append(keys, "maxMessageDepth")
+		after.MaxMessageDepth = before.MaxMessageDepth
+	}
+	if before.MaxBatchLength != after.MaxBatchLength {
+		keys = append(keys, "maxBatchLength")
+		after.MaxBatchLength = before.MaxBatchLength
+	}
+	return keys
+}
+
+func configChanges(before *domain.Config, after *domain.Config) []string {
+	changes := []string{}
+	add := func(key string, changed bool) {
+		if changed {
+			changes = append(changes, key)
+		}
+	}
+
+	listeners := []struct {
+		name   string
+		before domain.ListenerConfig
+		after  domain.ListenerConfig
+	}{
+		{name: "inside", before: before.Inside, after: after.Inside},
+		{name: "outside", before: before.Outside, after: after.Outside},
+	}
+	for _, l := range listeners {
+		add(l.name+".listen", !equalStrings(l.before.Listen, l.after.Listen))
+		add(l.name+".allow", l.before.Allow != l.after.Allow)
+		add(l.name+".allowOrigins", !equalStrings(l.before.AllowOrigins, l.after.AllowOrigins))
+		add(l.name+".tokenFile", l.before.TokenFile != l.after.TokenFile)
+		add(l.name+".tlsCert", l.before.TLSCert != l.after.TLSCert)
+		add(l.name+".tlsKey", l.before.TLSKey != l.after.TLSKey)
+		add(l.name+".defaultFilter", string(l.before.DefaultFilter) != string(l.after.DefaultFilter))
+	}
+	add("admin.listen", !equalStrings(before.Admin.Listen, after.Admin.Listen))
+	add("admin.tokenFile", before.Admin.TokenFile != after.Admin.TokenFile)
+	add("correlationKey", before.CorrelationKey != after.CorrelationKey)
+	add("retainKey", before.RetainKey != after.RetainKey)
+	add("sendQueueSize", before.SendQueueSize != after.SendQueueSize)
+	add("sendQueuePolicy", before.SendQueuePolicy != after.SendQueuePolicy)
+	add("maxMessageSize", before.MaxMessageSize != after.MaxMessageSize)
+	add("maxMessageDepth", before.MaxMessageDepth != after.MaxMessageDepth)
+	add("maxBatchLength", before.MaxBatchLength != after.MaxBatchLength)
+
+	return changes
+}
+
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
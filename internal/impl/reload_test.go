@@ -0,0 +1,186 @@
+package impl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/notomo/wsxhub/internal/domain"
+)
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsxhub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "wsxhub.json")
+	write := func(source string) {
+		if err := ioutil.WriteFile(path, []byte(source), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tokenPath := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenPath, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	newReloader := func() *ConfigReloaderImpl {
+		write(`{"outside": {"listen": [":8001"], "allow": "localhost:8001"}}`)
+		configFactory := &ConfigFactoryImpl{FilterClauseFactory: &FilterClauseFactoryImpl{}}
+		config, err := configFactory.Config(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		newFactory := func(listener domain.ListenerConfig) *ServerFactoryImpl {
+			factory, err := NewServerFactory(config, listener, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			settings, err := factory.newSettings()
+			if err != nil {
+				t.Fatal(err)
+			}
+			factory.setSettings(settings)
+			return factory
+		}
+		return &ConfigReloaderImpl{
+			ConfigFactory:        configFactory,
+			Path:                 path,
+			Config:               config,
+			InsideServerFactory:  newFactory(config.Inside),
+			OutsideServerFactory: newFactory(config.Outside),
+		}
+	}
+
+	t.Run("reloadable", func(t *testing.T) {
+		reloader := newReloader()
+		write(`{
+			"outside": {
+				"listen": [":8001"],
+				"allow": "example.com",
+				"allowOrigins": ["chrome-extension://*"],
+				"tokenFile": "` + tokenPath + `",
+				"defaultFilter": {"filters": [{"map": {"method": "open"}}]}
+			},
+			"sendQueueSize": 8,
+			"sendQueuePolicy": "disconnect"
+		}`)
+
+		if err := reloader.Reload(); err != nil {
+			t.Fatal(err)
+		}
+
+		settings := reloader.OutsideServerFactory.currentSettings()
+		if got, want := settings.hostPattern.String(), "example.com"; got != want {
+			t.Errorf("want %v, but %v", want, got)
+		}
+		if got, want := settings.origins, (originPatterns{"chrome-extension://*"}); !reflect.DeepEqual(got, want) {
+			t.Errorf("want %v, but %v", want, got)
+		}
+		if got, want := settings.token, "secret"; got != want {
+			t.Errorf("want %v, but %v", want, got)
+		}
+		if got, want := settings.defaultFilterSource, `{"filters": [{"map": {"method": "open"}}]}`; got != want {
+			t.Errorf("want %v, but %v", want, got)
+		}
+		if got, want := settings.queueSize, 8; got != want {
+			t.Errorf("want %v, but %v", want, got)
+		}
+		if got, want := settings.overflowPolicy, domain.OverflowPolicyDisconnect; got != want {
+			t.Errorf("want %v, but %v", want, got)
+		}
+		if got, want := reloader.InsideServerFactory.currentSettings().queueSize, 8; got != want {
+			t.Errorf("want %v, but %v", want, got)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		reloader := newReloader()
+		before := reloader.OutsideServerFactory.currentSettings()
+		write(`{"outside": {"listen": [":8001"], "allow": "example.com", "allowOrigins": ["example.com"]}}`)
+
+		if err := reloader.Reload(); err == nil {
+			t.Fatal("should be error")
+		}
+
+		if got := reloader.OutsideServerFactory.currentSettings(); got != before {
+			t.Errorf("should not be applied: %v", got)
+		}
+		if got, want := reloader.Config.Outside.Allow, "localhost:8001"; got != want {
+			t.Errorf("want %v, but %v", want, got)
+		}
+	})
+
+	t.Run("restart required", func(t *testing.T) {
+		reloader := newReloader()
+		write(`{"outside": {"listen": [":9001"], "allow": "example.com"}, "correlationKey": "id"}`)
+
+		if err := reloader.Reload(); err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := reloader.Config.Outside.Listen, []string{":8001"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("want %v, but %v", want, got)
+		}
+		if got, want := reloader.Config.CorrelationKey, ""; got != want {
+			t.Errorf("want %v, but %v", want, got)
+		}
+		if got, want := reloader.Config.Outside.Allow, "example.com"; got != want {
+			t.Errorf("want %v, but %v", want, got)
+		}
+	})
+
+	t.Run("retain key", func(t *testing.T) {
+		reloader := newReloader()
+		worker := NewWorker("test")
+		worker.Retained["channel"] = newRetainedMessages()
+		reloader.Workers = []*WorkerImpl{worker}
+		finished := make(chan error)
+		go func() {
+			finished <- worker.Run()
+		}()
+		write(`{"outside": {"listen": [":8001"], "allow": "localhost:8001"}, "retainKey": "params.uri"}`)
+
+		if err := reloader.Reload(); err != nil {
+			t.Fatal(err)
+		}
+		worker.Finish()
+		select {
+		case <-finished:
+		case <-time.After(1 * time.Second):
+			t.Fatal("timeout")
+		}
+
+		if got, want := worker.RetainKey, "params.uri"; got != want {
+			t.Errorf("want %v, but %v", want, got)
+		}
+		if got := len(worker.Retained); got != 0 {
+			t.Errorf("should forget the retained messages: %v", worker.Retained)
+		}
+	})
+}
+
+func TestConfigChanges(t *testing.T) {
+	before := DefaultConfig()
+	after := DefaultConfig()
+	after.Inside.Listen = []string{"/tmp/wsxhub.sock"}
+	after.Outside.AllowOrigins = []string{"chrome-extension://*"}
+	after.Outside.TLSCert = "cert.pem"
+	after.RetainKey = "method"
+	after.MaxMessageSize = 1024
+
+	restartRequired := keepRestartRequired(before, after)
+	changes := configChanges(before, after)
+
+	if want := []string{"inside.listen", "outside.tlsCert", "maxMessageSize"}; !reflect.DeepEqual(restartRequired, want) {
+		t.Errorf("want %v, but %v", want, restartRequired)
+	}
+	if want := []string{"outside.allowOrigins", "retainKey"}; !reflect.DeepEqual(changes, want) {
+		t.Errorf("want %v, but %v", want, changes)
+	}
+}
@@ -1,11 +1,20 @@
 package impl
 
 import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"log"
+	"net"
 	"net/http"
+	"os"
 	"regexp"
 	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/notomo/wsxhub/internal/domain"
@@ -14,39 +23,160 @@ import (
 
 // ServerFactoryImpl :
 type ServerFactoryImpl struct {
-	Port                string
+	Addresses           []string
 	Worker              domain.Worker
 	TargetWorker        domain.Worker
 	FilterClauseFactory domain.FilterClauseFactory
+	TransformerFactory  domain.TransformerFactory
 	MessageFactory      domain.MessageFactory
 	HostPattern         string
+	AllowedOrigins      []string
+	CorrelationKey      string
+	QueueSize           int
+	OverflowPolicy      domain.OverflowPolicy
+	TLSCertFile         string
+	TLSKeyFile          string
+	Token               string
+	DefaultFilterSource string
+	Side                string
+	MaxMessageSize      int64
+	Metrics             *Metrics
+	Logger              domain.Logger
+
+	mutex    sync.RWMutex
+	settings *serverSettings
+}
+
+// serverSettings : the settings applied to each new connection, which can be reloaded while serving
+type serverSettings struct {
+	hostPattern         *regexp.Regexp
+	origins             originPatterns
+	token               string
+	defaultFilterSource string
+	queueSize           int
+	overflowPolicy      domain.OverflowPolicy
+}
+
+// NewServerFactory : creates the factory from the config without the workers and the other factories
+func NewServerFactory(config *domain.Config, listener domain.ListenerConfig, tokenEnvName string) (*ServerFactoryImpl, error) {
+	token, err := ReadToken(listener.TokenFile, tokenEnvName)
+	if err != nil {
+		return nil, err
+	}
+	return &ServerFactoryImpl{
+		Addresses:           listener.Listen,
+		HostPattern:         listener.Allow,
+		AllowedOrigins:      listener.AllowOrigins,
+		QueueSize:           config.SendQueueSize,
+		OverflowPolicy:      config.SendQueuePolicy,
+		TLSCertFile:         listener.TLSCert,
+		TLSKeyFile:          listener.TLSKey,
+		Token:               token,
+		DefaultFilterSource: string(listener.DefaultFilter),
+		MaxMessageSize:      config.MaxMessageSize,
+	}, nil
+}
+
+func (factory *ServerFactoryImpl) newSettings() (*serverSettings, error) {
+	compiled, err := regexp.Compile(factory.HostPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := factory.OverflowPolicy.Validate(); err != nil {
+		return nil, err
+	}
+
+	origins, err := newOriginPatterns(factory.AllowedOrigins)
+	if err != nil {
+		return nil, err
+	}
+
+	return &serverSettings{
+		hostPattern:         compiled,
+		origins:             origins,
+		token:               factory.Token,
+		defaultFilterSource: factory.DefaultFilterSource,
+		queueSize:           factory.QueueSize,
+		overflowPolicy:      factory.OverflowPolicy,
+	}, nil
+}
+
+// setSettings : applies the settings to the new connections and keeps the existing connections as is
+func (factory *ServerFactoryImpl) setSettings(settings *serverSettings) {
+	factory.mutex.Lock()
+	defer factory.mutex.Unlock()
+	factory.settings = settings
+}
+
+func (factory *ServerFactoryImpl) currentSettings() *serverSettings {
+	factory.mutex.RLock()
+	defer factory.mutex.RUnlock()
+	return factory.settings
 }
 
 // Server :
 func (factory *ServerFactoryImpl) Server(
 	routes ...domain.Route,
 ) (domain.Server, error) {
-	compiled, err := regexp.Compile(factory.HostPattern)
+	settings, err := factory.newSettings()
 	if err != nil {
 		return nil, err
 	}
+	factory.setSettings(settings)
 
-	upgrader := websocket.Upgrader{
-		ReadBufferSize:  1024,
-		WriteBufferSize: 1024,
-		CheckOrigin: func(req *http.Request) bool {
-			return compiled.Match([]byte(req.Host))
-		},
+	if err := validateAddresses(factory.Addresses); err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := factory.tlsConfig()
+	if err != nil {
+		return nil, err
 	}
 
 	mux := http.NewServeMux()
 	for _, route := range routes {
+		route := route
 		mux.HandleFunc(route.Path, func(w http.ResponseWriter, req *http.Request) {
-			filterClause, err := factory.FilterClauseFactory.FilterClause(req.FormValue("filter"))
+			settings := factory.currentSettings()
+			logger := factory.logger().With("remote", req.RemoteAddr)
+
+			if !settings.hostPattern.MatchString(req.Host) {
+				http.Error(w, "forbidden host", http.StatusForbidden)
+				logger.Warn("rejected host", "host", req.Host)
+				return
+			}
+
+			if !settings.authorized(req) {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				logger.Warn("unauthorized")
+				return
+			}
+
+			channel, err := toChannel(req.URL.Path)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				logger.Warn("not found", "error", err)
+				return
+			}
+
+			filterSource := req.FormValue("filter")
+			if filterSource == "" {
+				filterSource = settings.defaultFilterSource
+			}
+			filterClause, err := factory.FilterClauseFactory.FilterClause(filterSource)
 			if err != nil {
 				msg := fmt.Sprintf("failed to create filterClause: %s", err)
 				http.Error(w, msg, http.StatusBadRequest)
-				log.Printf(msg)
+				logger.Warn("failed to create filterClause", "error", err)
+				return
+			}
+
+			transformer, err := factory.TransformerFactory.Transformer(req.FormValue("transform"))
+			if err != nil {
+				msg := fmt.Sprintf("failed to create transformer: %s", err)
+				http.Error(w, msg, http.StatusBadRequest)
+				logger.Warn("failed to create transformer", "error", err)
 				return
 			}
 
@@ -57,58 +187,319 @@ func (factory *ServerFactoryImpl) Server(
 				if err != nil {
 					msg := fmt.Sprintf("failed to parse debounce: %s", err)
 					http.Error(w, msg, http.StatusBadRequest)
-					log.Printf(msg)
+					logger.Warn("failed to parse debounce", "error", err)
 					return
 				}
 			}
 
-			ws, err := upgrader.Upgrade(w, req, nil)
+			correlationKey := ""
+			if req.FormValue("correlate") == "true" {
+				correlationKey = factory.CorrelationKey
+			}
+			// the sender waits for the progress replies like send --until
+			multipleReplies := req.FormValue("multiple") == "true"
+
+			ws, err := settings.upgrader(logger).Upgrade(w, req, nil)
 			if err != nil {
-				log.Printf("failed to upgrade: %s", err)
+				logger.Warn("failed to upgrade", "error", err)
 				return
 			}
+			if factory.MaxMessageSize > 0 {
+				// closes the connection with 1009 (message too big) if exceeded
+				ws.SetReadLimit(factory.MaxMessageSize)
+			}
 
 			conn := &ConnectionImpl{
 				websocketClient: &WebsocketClientImpl{
-					ws: ws,
+					ws:           ws,
+					writeTimeout: serverWriteTimeout,
 				},
-				worker:         factory.Worker,
-				targetWorker:   factory.TargetWorker,
-				id:             xid.New().String(),
-				filterClause:   filterClause,
-				debounce:       debounce,
-				messageFactory: factory.MessageFactory,
+				worker:          factory.Worker,
+				targetWorker:    factory.TargetWorker,
+				id:              xid.New().String(),
+				channel:         channel,
+				filterClause:    filterClause,
+				debounce:        debounce,
+				messageFactory:  factory.MessageFactory,
+				correlationKey:  correlationKey,
+				multipleReplies: multipleReplies,
+				skipRetained:    req.FormValue("retained") == "false",
+				transformer:     transformer,
+				overflowPolicy:  settings.overflowPolicy,
+				remoteAddress:   req.RemoteAddr,
+				filterSource:    filterSource,
+				connectedAt:     time.Now(),
+				side:            factory.Side,
+				metrics:         factory.Metrics,
+			}
+			if settings.queueSize > 0 {
+				conn.queue = make(chan []byte, settings.queueSize)
 			}
 			defer conn.Close()
 
 			if err := route.Handler(conn); err != nil {
-				log.Print(err)
+				logger.Error("disconnected by error", "connection", conn.ID(), "error", err)
 			}
 		})
 	}
 
 	server := &http.Server{
-		Addr:    ":" + factory.Port,
-		Handler: mux,
+		Handler:   mux,
+		TLSConfig: tlsConfig,
 	}
 
 	return &ServerImpl{
 		httpServer: server,
 		worker:     factory.Worker,
+		addresses:  factory.Addresses,
+	}, nil
+}
+
+func (factory *ServerFactoryImpl) logger() domain.Logger {
+	logger := loggerOrDefault(factory.Logger)
+	if factory.Side == "" {
+		return logger
+	}
+	return logger.With(workerLogKey, factory.Side)
+}
+
+// isSocketAddress : the address like `/run/wsxhub.sock` is a unix socket path, otherwise `host:port`
+func isSocketAddress(address string) bool {
+	return strings.ContainsAny(address, `/\`)
+}
+
+func validateAddresses(addresses []string) error {
+	if len(addresses) == 0 {
+		return errors.New("no listen address")
+	}
+	for _, address := range addresses {
+		if err := validateAddress(address); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateAddress(address string) error {
+	if isSocketAddress(address) {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return fmt.Errorf("invalid listen address: %s", err)
+	}
+	return nil
+}
+
+func (factory *ServerFactoryImpl) tlsConfig() (*tls.Config, error) {
+	if factory.TLSCertFile == "" && factory.TLSKeyFile == "" {
+		return nil, nil
+	}
+	if factory.TLSCertFile == "" || factory.TLSKeyFile == "" {
+		return nil, errors.New("both tls certificate and key are required")
+	}
+
+	certificate, err := tls.LoadX509KeyPair(factory.TLSCertFile, factory.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{certificate},
 	}, nil
 }
 
+const bearerPrefix = "Bearer "
+
+func (settings *serverSettings) authorized(req *http.Request) bool {
+	return authorized(req, settings.token)
+}
+
+// authorized : accepts `Authorization: Bearer <token>` or `?token=<token>` for browsers
+func authorized(req *http.Request, want string) bool {
+	if want == "" {
+		return true
+	}
+
+	token := req.URL.Query().Get("token")
+	if header := req.Header.Get("Authorization"); strings.HasPrefix(header, bearerPrefix) {
+		token = strings.TrimPrefix(header, bearerPrefix)
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(want)) == 1
+}
+
+func (settings *serverSettings) upgrader(logger domain.Logger) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin: func(req *http.Request) bool {
+			origin := req.Header.Get("Origin")
+			if settings.origins.Allowed(origin) {
+				return true
+			}
+			logger.Warn("rejected origin", "origin", origin)
+			return false
+		},
+	}
+}
+
+func toChannel(path string) (string, error) {
+	if !strings.HasPrefix(path, domain.ChannelPathPrefix) {
+		return "", nil
+	}
+	channel := strings.TrimPrefix(path, domain.ChannelPathPrefix)
+	if channel == "" || strings.Contains(channel, "/") {
+		return "", fmt.Errorf("invalid channel path: %s", path)
+	}
+	return channel, nil
+}
+
+const shutdownTimeout = 5 * time.Second
+
+// serverWriteTimeout : a client not reading the messages can't block the others and the shutdown
+const serverWriteTimeout = 10 * time.Second
+
 // ServerImpl :
+// The worker is nil for the server without websocket connections like the admin server.
 type ServerImpl struct {
 	httpServer *http.Server
 	worker     domain.Worker
+	addresses  []string
+	mutex      sync.Mutex
+	running    bool
+	shutdown   bool
 }
 
-// Start :
+// Start : listens and runs the worker until shutdown
 func (server *ServerImpl) Start() error {
-	go func() {
-		server.httpServer.ListenAndServe()
-	}()
+	listeners, err := server.listen()
+	if err != nil {
+		return err
+	}
+	if listeners == nil {
+		return nil
+	}
+
+	// Serve sets up TLSConfig for HTTP/2, so decide before serving
+	useTLS := server.httpServer.TLSConfig != nil
+	served := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		go func(listener net.Listener) {
+			if useTLS {
+				served <- server.httpServer.ServeTLS(listener, "", "")
+				return
+			}
+			served <- server.httpServer.Serve(listener)
+		}(listener)
+	}
+
+	finished := make(chan error, 1)
+	if server.worker != nil {
+		go func() {
+			finished <- server.worker.Run()
+		}()
+	}
+
+	select {
+	case err := <-served:
+		if err == http.ErrServerClosed && server.worker == nil {
+			return nil
+		}
+		if err == http.ErrServerClosed {
+			return <-finished
+		}
+		return err
+	case err := <-finished:
+		return err
+	}
+}
+
+func (server *ServerImpl) listen() ([]net.Listener, error) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	// shut down before starting
+	if server.shutdown {
+		return nil, nil
+	}
+
+	listeners := []net.Listener{}
+	for _, address := range server.addresses {
+		listener, err := listenAddress(address)
+		if err != nil {
+			for _, listener := range listeners {
+				listener.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+	}
+	server.running = true
+	return listeners, nil
+}
+
+func listenAddress(address string) (net.Listener, error) {
+	if !isSocketAddress(address) {
+		return net.Listen("tcp", address)
+	}
+
+	if err := removeStaleSocket(address); err != nil {
+		return nil, err
+	}
+	return listenSocket(address)
+}
+
+// socketUmask : only the owner can connect to the socket from its creation
+const socketUmask = 0177
+
+// umaskMutex : the umask is for the whole process
+var umaskMutex sync.Mutex
+
+func listenSocket(address string) (net.Listener, error) {
+	umaskMutex.Lock()
+	defer umaskMutex.Unlock()
+	umask := syscall.Umask(socketUmask)
+	defer syscall.Umask(umask)
+	return net.Listen("unix", address)
+}
+
+// removeStaleSocket : removes the socket file left by the crashed server
+func removeStaleSocket(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("not a socket: %s", path)
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("socket already in use: %s", path)
+	}
+	return os.Remove(path)
+}
+
+// Shutdown : stops accepting connections and closes the connections gracefully
+func (server *ServerImpl) Shutdown() error {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.shutdown = true
+	if !server.running {
+		return nil
+	}
+	server.running = false
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := server.httpServer.Shutdown(ctx)
+
+	if server.worker != nil {
+		server.worker.Finish()
+	}
 
-	return server.worker.Run()
+	return err
 }
@@ -0,0 +1,319 @@
+package impl
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/notomo/wsxhub/internal/domain"
+	"github.com/notomo/wsxhub/internal/mock"
+)
+
+func TestAuthorized(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		target string
+		header string
+		want   bool
+	}{
+		{
+			name:   "no token required",
+			token:  "",
+			target: "/",
+			want:   true,
+		},
+		{
+			name:   "bearer",
+			token:  "secret",
+			target: "/",
+			header: "Bearer secret",
+			want:   true,
+		},
+		{
+			name:   "query",
+			token:  "secret",
+			target: "/?token=secret",
+			want:   true,
+		},
+		{
+			name:   "missing",
+			token:  "secret",
+			target: "/",
+			want:   false,
+		},
+		{
+			name:   "wrong bearer",
+			token:  "secret",
+			target: "/?token=secret",
+			header: "Bearer wrong",
+			want:   false,
+		},
+		{
+			name:   "not bearer",
+			token:  "secret",
+			target: "/",
+			header: "Basic secret",
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := &serverSettings{token: tt.token}
+
+			req := httptest.NewRequest("GET", tt.target, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+
+			got := settings.authorized(req)
+
+			if got != tt.want {
+				t.Errorf("want %v, but %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestServerOrigin(t *testing.T) {
+	tests := []struct {
+		name   string
+		host   string
+		origin string
+		// noAllowlist : without --outside-allow-origin
+		noAllowlist bool
+		want        int
+	}{
+		{
+			name:   "non-browser client",
+			origin: "",
+			want:   http.StatusSwitchingProtocols,
+		},
+		{
+			name:   "allowed origin",
+			origin: "https://app.example.com",
+			want:   http.StatusSwitchingProtocols,
+		},
+		{
+			name:   "allowed extension",
+			origin: "chrome-extension://abcdefghijklmnop",
+			want:   http.StatusSwitchingProtocols,
+		},
+		{
+			name:   "page on the other origin",
+			origin: "https://evil.example.org",
+			want:   http.StatusForbidden,
+		},
+		{
+			name:        "page without allowlist",
+			origin:      "https://example.com",
+			noAllowlist: true,
+			want:        http.StatusForbidden,
+		},
+		{
+			name:        "extension without allowlist",
+			origin:      "moz-extension://0a1b2c3d-4e5f",
+			noAllowlist: true,
+			want:        http.StatusSwitchingProtocols,
+		},
+		{
+			name:   "forbidden host",
+			host:   "evil.example.org",
+			origin: "",
+			want:   http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			factory := &ServerFactoryImpl{
+				Worker: &mock.FakeWorker{
+					FakeDelete: func(domain.Connection) error {
+						return nil
+					},
+				},
+				FilterClauseFactory: &FilterClauseFactoryImpl{},
+				TransformerFactory:  &TransformerFactoryImpl{},
+				Addresses:           []string{"127.0.0.1:0"},
+				HostPattern:         "^127.0.0.1:",
+				AllowedOrigins:      []string{"https://*.example.com", "chrome-extension://*"},
+			}
+			if tt.noAllowlist {
+				factory.AllowedOrigins = nil
+			}
+			server, err := factory.Server(domain.NewRoute("/", func(domain.Connection) error {
+				return nil
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			httpServer := httptest.NewServer(server.(*ServerImpl).httpServer.Handler)
+			defer httpServer.Close()
+
+			header := http.Header{}
+			if tt.host != "" {
+				header.Set("Host", tt.host)
+			}
+			if tt.origin != "" {
+				header.Set("Origin", tt.origin)
+			}
+			u := "ws" + strings.TrimPrefix(httpServer.URL, "http") + "/"
+			conn, resp, _ := websocket.DefaultDialer.Dial(u, header)
+			if conn != nil {
+				conn.Close()
+			}
+
+			if resp == nil {
+				t.Fatal("no response")
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("want %v, but %v", tt.want, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestRemoveStaleSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsxhub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	t.Run("not exist", func(t *testing.T) {
+		if err := removeStaleSocket(filepath.Join(dir, "notExist.sock")); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("stale", func(t *testing.T) {
+		path := filepath.Join(dir, "stale.sock")
+		listener, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		listener.(*net.UnixListener).SetUnlinkOnClose(false)
+		listener.Close()
+
+		if err := removeStaleSocket(path); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("should be removed: %s", path)
+		}
+	})
+
+	t.Run("in use", func(t *testing.T) {
+		path := filepath.Join(dir, "inUse.sock")
+		listener, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+
+		if err := removeStaleSocket(path); err == nil {
+			t.Fatal("should be error")
+		}
+	})
+
+	t.Run("not socket", func(t *testing.T) {
+		path := filepath.Join(dir, "file")
+		if err := ioutil.WriteFile(path, []byte{}, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := removeStaleSocket(path); err == nil {
+			t.Fatal("should be error")
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("should not be removed: %s", path)
+		}
+	})
+}
+
+func TestListenSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsxhub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the permissive umask must not be used for the socket
+	umask := syscall.Umask(0)
+	defer syscall.Umask(umask)
+
+	path := filepath.Join(dir, "wsxhub.sock")
+	listener, err := listenAddress(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := info.Mode().Perm(), os.FileMode(0600); got != want {
+		t.Errorf("want %v, but %v:", want, got)
+	}
+}
+
+func TestValidateAddresses(t *testing.T) {
+	tests := []struct {
+		name      string
+		addresses []string
+		valid     bool
+	}{
+		{
+			name:      "port only",
+			addresses: []string{":8001"},
+			valid:     true,
+		},
+		{
+			name:      "host and ipv6",
+			addresses: []string{"127.0.0.1:8001", "[::1]:8001"},
+			valid:     true,
+		},
+		{
+			name:      "socket",
+			addresses: []string{"/tmp/wsxhub.sock"},
+			valid:     true,
+		},
+		{
+			name:      "empty",
+			addresses: []string{},
+			valid:     false,
+		},
+		{
+			name:      "no port",
+			addresses: []string{"127.0.0.1"},
+			valid:     false,
+		},
+		{
+			name:      "ipv6 without brackets",
+			addresses: []string{"::1:8001"},
+			valid:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAddresses(tt.addresses)
+
+			if tt.valid && err != nil {
+				t.Errorf("should be valid: %s", err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("should be invalid: %v", tt.addresses)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package impl
+
+import (
+	"bufio"
+	"io"
+)
+
+// jsonScanner : splits the newline delimited or concatenated json values without decoding.
+// A value can span lines like pretty printed json,
+// but a line starting with `{` or `[` that can't continue the value starts a new value
+// so that a broken line doesn't swallow the following lines.
+type jsonScanner struct {
+	reader    *bufio.Reader
+	eof       bool
+	rest      []byte
+	line      int
+	lineStart bool
+
+	value     []byte
+	valueLine int
+	// containers : the opening brackets of the unclosed maps and arrays
+	containers []byte
+	// last : the last byte outside the strings except the spaces
+	last     byte
+	inString bool
+	escaped  bool
+}
+
+func newJSONScanner(reader io.Reader) *jsonScanner {
+	return &jsonScanner{
+		reader: bufio.NewReader(reader),
+	}
+}
+
+// Next : returns the next value and its first line number, or io.EOF
+func (scanner *jsonScanner) Next() ([]byte, int, error) {
+	for {
+		if len(scanner.rest) == 0 {
+			if scanner.eof {
+				if len(scanner.value) != 0 {
+					return scanner.flush(), scanner.valueLine, nil
+				}
+				return nil, 0, io.EOF
+			}
+			line, err := scanner.reader.ReadBytes('\n')
+			if err == io.EOF {
+				scanner.eof = true
+			} else if err != nil {
+				return nil, 0, err
+			}
+			if len(line) == 0 {
+				continue
+			}
+			scanner.rest = line
+			scanner.line++
+			scanner.lineStart = true
+		}
+
+		if scanner.lineStart && len(scanner.value) != 0 && isValueStart(scanner.rest[0]) && !scanner.acceptsValue() {
+			return scanner.flush(), scanner.valueLine, nil
+		}
+		scanner.lineStart = false
+
+		if value, line, ok := scanner.scan(); ok {
+			return value, line, nil
+		}
+	}
+}
+
+// scan : consumes the rest of the line until a value ends
+func (scanner *jsonScanner) scan() ([]byte, int, bool) {
+	for i, b := range scanner.rest {
+		if len(scanner.value) == 0 {
+			switch {
+			case isJSONSpace(b):
+				continue
+			case isValueStart(b):
+				scanner.valueLine = scanner.line
+				scanner.containers = append(scanner.containers, b)
+				scanner.last = b
+				scanner.value = append(scanner.value, b)
+				continue
+			}
+			// not a map or an array: reports the rest of the line as the invalid value
+			scanner.value = append(scanner.value, scanner.rest[i:]...)
+			scanner.valueLine = scanner.line
+			scanner.rest = nil
+			return scanner.flush(), scanner.valueLine, true
+		}
+
+		scanner.value = append(scanner.value, b)
+		if scanner.inString {
+			switch {
+			case scanner.escaped:
+				scanner.escaped = false
+			case b == '\\':
+				scanner.escaped = true
+			case b == '"':
+				scanner.inString = false
+				scanner.last = b
+			case b == '\n':
+				// a raw newline is invalid in the string, so the value is broken
+				scanner.rest = scanner.rest[i+1:]
+				return scanner.flush(), scanner.valueLine, true
+			}
+			continue
+		}
+		if !isJSONSpace(b) {
+			scanner.last = b
+		}
+		switch b {
+		case '"':
+			scanner.inString = true
+		case '{', '[':
+			scanner.containers = append(scanner.containers, b)
+		case '}', ']':
+			scanner.containers = scanner.containers[:len(scanner.containers)-1]
+		}
+		if len(scanner.containers) == 0 {
+			scanner.rest = scanner.rest[i+1:]
+			return scanner.flush(), scanner.valueLine, true
+		}
+	}
+	scanner.rest = nil
+	return nil, 0, false
+}
+
+func (scanner *jsonScanner) flush() []byte {
+	value := scanner.value
+	scanner.value = nil
+	scanner.containers = nil
+	scanner.last = 0
+	scanner.inString = false
+	scanner.escaped = false
+	return value
+}
+
+// acceptsValue : whether a map or an array can come next in the value like after `:` or `[`
+func (scanner *jsonScanner) acceptsValue() bool {
+	switch scanner.last {
+	case ':':
+		return true
+	case '[', ',':
+		return scanner.containers[len(scanner.containers)-1] == '['
+	}
+	return false
+}
+
+func isValueStart(b byte) bool {
+	return b == '{' || b == '['
+}
+
+func isJSONSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+}
@@ -0,0 +1,122 @@
+package impl
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/notomo/wsxhub/internal/domain"
+)
+
+func TestJSONScanner(t *testing.T) {
+	type value struct {
+		line  int
+		value string
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  []value
+	}{
+		{
+			name:  "newline delimited",
+			input: "{\"id\":1}\n\n[{\"id\":2}]\n",
+			want:  []value{{1, `{"id":1}`}, {3, `[{"id":2}]`}},
+		},
+		{
+			name:  "concatenated",
+			input: `{"id":1}{"id":2} {"id":"}{"}`,
+			want:  []value{{1, `{"id":1}`}, {1, `{"id":2}`}, {1, `{"id":"}{"}`}},
+		},
+		{
+			name:  "pretty printed",
+			input: "{\n  \"params\": {\n    \"id\": 1\n  }\n}\n{\n  \"id\": 2\n}",
+			want:  []value{{1, "{\n  \"params\": {\n    \"id\": 1\n  }\n}"}, {6, "{\n  \"id\": 2\n}"}},
+		},
+		{
+			name:  "value at the first column in a map",
+			input: "{\n\"items\":\n[1, 2]\n}\n{\"id\":2}",
+			want:  []value{{1, "{\n\"items\":\n[1, 2]\n}"}, {5, `{"id":2}`}},
+		},
+		{
+			name:  "values at the first column in an array",
+			input: "[\n{\"id\":1},\n{\"id\":2}\n]",
+			want:  []value{{1, "[\n{\"id\":1},\n{\"id\":2}\n]"}},
+		},
+		{
+			name:  "broken line after comma in a map",
+			input: "{\"id\":1,\n{\"id\":2}\n",
+			want:  []value{{1, "{\"id\":1,\n"}, {2, `{"id":2}`}},
+		},
+		{
+			name:  "broken line",
+			input: "{\"id\":1\n{\"id\":2}\n",
+			want:  []value{{1, "{\"id\":1\n"}, {2, `{"id":2}`}},
+		},
+		{
+			name:  "newline in string",
+			input: "{\"id\":\"1\n\"} {\"id\":2}",
+			want:  []value{{1, "{\"id\":\"1\n"}, {2, `"} {"id":2}`}},
+		},
+		{
+			name:  "not map",
+			input: "1 {}\n{}",
+			want:  []value{{1, "1 {}\n"}, {2, `{}`}},
+		},
+		{
+			name:  "unterminated",
+			input: `{"id":`,
+			want:  []value{{1, `{"id":`}},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			scanner := newJSONScanner(bytes.NewBufferString(test.input))
+
+			got := []value{}
+			for {
+				v, line, err := scanner.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, value{line, string(v)})
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("want %q, but %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestFromStream(t *testing.T) {
+	factory := MessageFactoryImpl{}
+	input := bytes.NewBufferString("{\"id\":1}\n{\"id\":1\n[{\"id\":2}]\n")
+
+	messages := []string{}
+	errs := []string{}
+	if err := factory.FromStream(input, func(message domain.Message, err error) error {
+		if err != nil {
+			errs = append(errs, err.Error())
+			return nil
+		}
+		messages = append(messages, string(message.Bytes()))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{`{"id":1}`, `[{"id":2}]`}; !reflect.DeepEqual(messages, want) {
+		t.Errorf("want %v, but %v", want, messages)
+	}
+	if want := []string{"line 2: invalid json: unexpected end of JSON input"}; !reflect.DeepEqual(errs, want) {
+		t.Errorf("want %v, but %v", want, errs)
+	}
+}
@@ -0,0 +1,212 @@
+package impl
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/notomo/wsxhub/internal/domain"
+)
+
+// TransformerFactoryImpl :
+type TransformerFactoryImpl struct {
+}
+
+// Transformer :
+func (factory *TransformerFactoryImpl) Transformer(source string) (domain.Transformer, error) {
+	var transformer TransformerImpl
+	if source == "" {
+		return &transformer, nil
+	}
+
+	if err := json.Unmarshal([]byte(source), &transformer); err != nil {
+		return nil, err
+	}
+
+	if err := transformer.compile(); err != nil {
+		return nil, err
+	}
+
+	return &transformer, nil
+}
+
+// TransformerImpl : picks, drops and then renames the fields of each map
+type TransformerImpl struct {
+	Pick   []string          `json:"pick"`
+	Drop   []string          `json:"drop"`
+	Rename map[string]string `json:"rename"`
+	Unwrap bool              `json:"unwrap"`
+	pick   [][]string
+	drop   [][]string
+	rename []renaming
+}
+
+type renaming struct {
+	from []string
+	to   []string
+}
+
+func (transformer *TransformerImpl) compile() error {
+	for _, source := range transformer.Pick {
+		keys, err := parseKeys(source)
+		if err != nil {
+			return err
+		}
+		transformer.pick = append(transformer.pick, keys)
+	}
+
+	for _, source := range transformer.Drop {
+		keys, err := parseKeys(source)
+		if err != nil {
+			return err
+		}
+		transformer.drop = append(transformer.drop, keys)
+	}
+
+	froms := []string{}
+	for from := range transformer.Rename {
+		froms = append(froms, from)
+	}
+	sort.Strings(froms)
+	for _, from := range froms {
+		fromKeys, err := parseKeys(from)
+		if err != nil {
+			return err
+		}
+		toKeys, err := parseKeys(transformer.Rename[from])
+		if err != nil {
+			return err
+		}
+		transformer.rename = append(transformer.rename, renaming{from: fromKeys, to: toKeys})
+	}
+
+	return nil
+}
+
+// parseKeys : parses a dotted key path that has no index and wildcard
+func parseKeys(source string) ([]string, error) {
+	path, err := parseKeyPath(source)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	for _, segment := range path {
+		if segment.isIndex || segment.wildcard {
+			return nil, fmt.Errorf("transform key path must be dotted keys, but actual: %s", source)
+		}
+		keys = append(keys, segment.key)
+	}
+	return keys, nil
+}
+
+// Transform :
+func (transformer *TransformerImpl) Transform(message domain.Message) ([][]byte, error) {
+	unwrap := transformer.Unwrap && message.Batch()
+	if !unwrap && len(transformer.pick) == 0 && len(transformer.drop) == 0 && len(transformer.rename) == 0 {
+		return [][]byte{message.Bytes()}, nil
+	}
+
+	maps := []map[string]interface{}{}
+	for _, m := range message.Unmarshaled() {
+		maps = append(maps, transformer.transform(m))
+	}
+
+	if message.Batch() && !unwrap {
+		bytes, err := json.Marshal(maps)
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{bytes}, nil
+	}
+
+	payloads := [][]byte{}
+	for _, m := range maps {
+		bytes, err := json.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		payloads = append(payloads, bytes)
+	}
+	return payloads, nil
+}
+
+func (transformer *TransformerImpl) transform(m map[string]interface{}) map[string]interface{} {
+	transformed := copyMap(m)
+
+	if len(transformer.pick) > 0 {
+		picked := map[string]interface{}{}
+		for _, keys := range transformer.pick {
+			if value, ok := getKeys(transformed, keys); ok {
+				setKeys(picked, keys, value)
+			}
+		}
+		transformed = picked
+	}
+
+	for _, keys := range transformer.drop {
+		deleteKeys(transformed, keys)
+	}
+
+	for _, r := range transformer.rename {
+		value, ok := getKeys(transformed, r.from)
+		if !ok {
+			continue
+		}
+		deleteKeys(transformed, r.from)
+		setKeys(transformed, r.to, value)
+	}
+
+	return transformed
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	copied := map[string]interface{}{}
+	for key, value := range m {
+		if nested, ok := value.(map[string]interface{}); ok {
+			value = copyMap(nested)
+		}
+		copied[key] = value
+	}
+	return copied
+}
+
+func getKeys(m map[string]interface{}, keys []string) (interface{}, bool) {
+	var value interface{} = m
+	for _, key := range keys {
+		nested, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		value, ok = nested[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func setKeys(m map[string]interface{}, keys []string, value interface{}) {
+	last := len(keys) - 1
+	for _, key := range keys[:last] {
+		nested, ok := m[key].(map[string]interface{})
+		if !ok {
+			nested = map[string]interface{}{}
+			m[key] = nested
+		}
+		m = nested
+	}
+	m[keys[last]] = value
+}
+
+func deleteKeys(m map[string]interface{}, keys []string) {
+	last := len(keys) - 1
+	for _, key := range keys[:last] {
+		nested, ok := m[key].(map[string]interface{})
+		if !ok {
+			return
+		}
+		m = nested
+	}
+	delete(m, keys[last])
+}
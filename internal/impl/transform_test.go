@@ -0,0 +1,135 @@
+package impl
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestTransform(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     string
+		rawMessage string
+		want       []string
+	}{
+		{
+			name:       "empty",
+			source:     "",
+			rawMessage: `{"id": "1"}`,
+			want:       []string{`{"id": "1"}`},
+		},
+		{
+			name:       "pick",
+			source:     `{"pick": ["method", "params.uri", "params.notFound"]}`,
+			rawMessage: `{"method":"open","params":{"uri":"file:///a","text":"large"}}`,
+			want:       []string{`{"method":"open","params":{"uri":"file:///a"}}`},
+		},
+		{
+			name:       "drop",
+			source:     `{"drop": ["params.text", "notFound.key"]}`,
+			rawMessage: `{"method":"open","params":{"uri":"file:///a","text":"large"}}`,
+			want:       []string{`{"method":"open","params":{"uri":"file:///a"}}`},
+		},
+		{
+			name:       "rename",
+			source:     `{"rename": {"params.uri": "uri", "method": "event.name"}}`,
+			rawMessage: `{"method":"open","params":{"uri":"file:///a"}}`,
+			want:       []string{`{"event":{"name":"open"},"params":{},"uri":"file:///a"}`},
+		},
+		{
+			name:       "pick and rename",
+			source:     `{"pick": ["params.uri"], "rename": {"params": "p"}}`,
+			rawMessage: `{"method":"open","params":{"uri":"file:///a","text":"large"}}`,
+			want:       []string{`{"p":{"uri":"file:///a"}}`},
+		},
+		{
+			name:       "batch",
+			source:     `{"pick": ["id"]}`,
+			rawMessage: `[{"id":"1","key":"value"},{"id":"2"}]`,
+			want:       []string{`[{"id":"1"},{"id":"2"}]`},
+		},
+		{
+			name:       "unwrap",
+			source:     `{"unwrap": true}`,
+			rawMessage: `[{"id":"1"},{"id":"2"}]`,
+			want:       []string{`{"id":"1"}`, `{"id":"2"}`},
+		},
+		{
+			name:       "unwrap not batch",
+			source:     `{"unwrap": true}`,
+			rawMessage: `{"id": "1"}`,
+			want:       []string{`{"id": "1"}`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			factory := &TransformerFactoryImpl{}
+			transformer, err := factory.Transformer(test.source)
+			if err != nil {
+				t.Fatalf("should not be error: %v", err)
+			}
+
+			message, err := (&MessageFactoryImpl{}).FromBytes([]byte(test.rawMessage))
+			if err != nil {
+				t.Fatalf("should not be error: %v", err)
+			}
+
+			unmarshaled := fmt.Sprint(message.Unmarshaled())
+
+			payloads, err := transformer.Transform(message)
+			if err != nil {
+				t.Fatalf("should not be error: %v", err)
+			}
+
+			got := []string{}
+			for _, payload := range payloads {
+				got = append(got, string(payload))
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("want %v, but %v:", test.want, got)
+			}
+
+			if string(message.Bytes()) != test.rawMessage {
+				t.Errorf("should not change the original message, but %s:", message.Bytes())
+			}
+			if got := fmt.Sprint(message.Unmarshaled()); got != unmarshaled {
+				t.Errorf("should not change the original maps, but %v:", got)
+			}
+		})
+	}
+}
+
+func TestInvalidTransformer(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{
+			name:   "invalid json",
+			source: `{`,
+		},
+		{
+			name:   "index in pick",
+			source: `{"pick": ["items[0]"]}`,
+		},
+		{
+			name:   "wildcard in drop",
+			source: `{"drop": ["params.*"]}`,
+		},
+		{
+			name:   "empty rename",
+			source: `{"rename": {"method": ""}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			factory := &TransformerFactoryImpl{}
+			if _, err := factory.Transformer(test.source); err == nil {
+				t.Errorf("should be error")
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package impl
+
+import (
+	"os"
+	"time"
+)
+
+// FileWatcher : detects the modification of the file by polling its modification time and size
+type FileWatcher struct {
+	Path     string
+	Interval time.Duration
+}
+
+// Watch : sends the path on each modification
+func (watcher *FileWatcher) Watch() <-chan string {
+	changed := make(chan string)
+	go func() {
+		last := watcher.stat()
+		for range time.Tick(watcher.Interval) {
+			current := watcher.stat()
+			if current == last {
+				continue
+			}
+			last = current
+			changed <- watcher.Path
+		}
+	}()
+	return changed
+}
+
+type fileStat struct {
+	exists  bool
+	modTime time.Time
+	size    int64
+}
+
+func (watcher *FileWatcher) stat() fileStat {
+	info, err := os.Stat(watcher.Path)
+	if err != nil {
+		return fileStat{}
+	}
+	return fileStat{
+		exists:  true,
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}
+}
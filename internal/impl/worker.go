@@ -1,8 +1,11 @@
 package impl
 
 import (
-	"log"
+	"encoding/json"
+	"sort"
+	"sync"
 
+	"github.com/notomo/wsxhub/internal"
 	"github.com/notomo/wsxhub/internal/domain"
 )
 
@@ -10,11 +13,29 @@ import (
 type WorkerImpl struct {
 	Name               string
 	Joined             chan domain.Connection
-	Received           chan domain.Message
+	Received           chan envelope
 	Left               chan domain.Connection
 	NotifiedSendResult chan error
+	Expected           chan domain.Request
+	RetainKeyChanged   chan string
+	Inspected          chan chan []domain.ConnectionInfo
 	Done               chan bool
+	Stopped            chan bool
 	Conns              map[string]domain.Connection
+	Channels           map[string]map[string]domain.Connection
+	Requests           map[string]domain.Request
+	RequestIDs         map[string]map[string]bool
+	CorrelationKey     string
+	Retained           map[string]*retainedMessages
+	RetainKey          string
+	retainPath         keyPath
+	Metrics            *Metrics
+	Logger             domain.Logger
+}
+
+type envelope struct {
+	channel string
+	message domain.Message
 }
 
 // NewWorker :
@@ -22,79 +43,433 @@ func NewWorker(name string) *WorkerImpl {
 	return &WorkerImpl{
 		Name:               name,
 		Joined:             make(chan domain.Connection),
-		Received:           make(chan domain.Message),
+		Received:           make(chan envelope),
 		Left:               make(chan domain.Connection),
 		NotifiedSendResult: make(chan error),
+		Expected:           make(chan domain.Request),
+		RetainKeyChanged:   make(chan string),
+		Inspected:          make(chan chan []domain.ConnectionInfo),
 		Done:               make(chan bool),
+		Stopped:            make(chan bool),
 		Conns:              make(map[string]domain.Connection),
+		Channels:           make(map[string]map[string]domain.Connection),
+		Requests:           make(map[string]domain.Request),
+		RequestIDs:         make(map[string]map[string]bool),
+		Retained:           make(map[string]*retainedMessages),
 	}
 }
 
 // Run :
 func (worker *WorkerImpl) Run() error {
-	log.Printf("(%s) start", worker.Name)
+	// the connections and the timers can call the worker after it stopped
+	defer close(worker.Stopped)
+
+	worker.logger().Info("start")
+	worker.retainPath = worker.parseRetainKey(worker.RetainKey)
 	for {
 		select {
 
 		case conn := <-worker.Joined:
 			worker.Conns[conn.ID()] = conn
-			log.Printf("(%s) joined: %s, count: %d", worker.Name, conn.ID(), len(worker.Conns))
+			if _, ok := worker.Channels[conn.Channel()]; !ok {
+				worker.Channels[conn.Channel()] = make(map[string]domain.Connection)
+			}
+			worker.Channels[conn.Channel()][conn.ID()] = conn
+			worker.Metrics.count(metricJoined, worker.Name)
+			worker.logger().Info("joined", connectionLogFields(conn, "count", len(worker.Conns))...)
+			worker.replay(conn)
 
 		case conn := <-worker.Left:
 			delete(worker.Conns, conn.ID())
-			log.Printf("(%s) left: %s, count: %d", worker.Name, conn.ID(), len(worker.Conns))
+			delete(worker.Channels[conn.Channel()], conn.ID())
+			if len(worker.Channels[conn.Channel()]) == 0 {
+				delete(worker.Channels, conn.Channel())
+			}
+			worker.Metrics.count(metricLeft, worker.Name)
+			for id := range worker.RequestIDs[conn.ID()] {
+				delete(worker.Requests, id)
+			}
+			delete(worker.RequestIDs, conn.ID())
+			worker.logger().Info("left", connectionLogFields(conn, "count", len(worker.Conns))...)
 
-		case message := <-worker.Received:
-			log.Printf("(%s) received", worker.Name)
+		case e := <-worker.Received:
+			message := e.message
+			worker.logger().Debug("received", "channel", e.channel, "size", len(message.Bytes()))
+			worker.Metrics.count(metricReceived, worker.Name)
 
-			for _, conn := range worker.Conns {
-				sent, err := conn.Send(message)
-				if err != nil {
-					log.Printf("(%s) failed to send: %s", worker.Name, err)
-					continue
+			if replies := worker.replies(message); len(replies) > 0 {
+				for _, reply := range replies {
+					worker.send(reply.conn, worker.restore(reply.message), "replied")
+					worker.forget(reply.ids)
 				}
-				if sent {
-					log.Printf("(%s) sent", worker.Name)
+				continue
+			}
+			worker.retain(e.channel, message)
+
+			for _, conn := range worker.Channels[e.channel] {
+				if conn.Correlated() {
+					continue
 				}
+				worker.send(conn, message, "sent")
 			}
 
+		case request := <-worker.Expected:
+			worker.Requests[request.ID] = request
+			if _, ok := worker.RequestIDs[request.Conn.ID()]; !ok {
+				worker.RequestIDs[request.Conn.ID()] = make(map[string]bool)
+			}
+			worker.RequestIDs[request.Conn.ID()][request.ID] = true
+
+		case key := <-worker.RetainKeyChanged:
+			worker.RetainKey = key
+			worker.retainPath = worker.parseRetainKey(key)
+			worker.Retained = make(map[string]*retainedMessages)
+			worker.logger().Info("retain key changed", "retainKey", key)
+
+		case infos := <-worker.Inspected:
+			infos <- worker.connectionInfos()
+
 		case err := <-worker.NotifiedSendResult:
 			if err != nil {
-				log.Printf("(%s) failed to send: %s", worker.Name, err)
+				worker.logger().Error("failed to send", "error", err)
 				continue
 			}
-			log.Printf("(%s) sent", worker.Name)
+			worker.logger().Debug("sent")
 
 		case <-worker.Done:
+			worker.shutdown()
 			return nil
 		}
 	}
 }
 
-// Add :
+func (worker *WorkerImpl) logger() domain.Logger {
+	return loggerOrDefault(worker.Logger).With(workerLogKey, worker.Name)
+}
+
+// connectionLogFields : prepends the fields to find the connection
+func connectionLogFields(conn domain.Connection, keyValues ...interface{}) []interface{} {
+	return append([]interface{}{"connection", conn.ID(), "remote", conn.RemoteAddress()}, keyValues...)
+}
+
+func (worker *WorkerImpl) connectionInfos() []domain.ConnectionInfo {
+	infos := []domain.ConnectionInfo{}
+	for _, conn := range worker.Conns {
+		info := conn.Info()
+		info.Side = worker.Name
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].ConnectedAt.Equal(infos[j].ConnectedAt) {
+			return infos[i].ID < infos[j].ID
+		}
+		return infos[i].ConnectedAt.Before(infos[j].ConnectedAt)
+	})
+	return infos
+}
+
+// reply : the part of the message for the requester
+type reply struct {
+	conn    domain.Connection
+	message domain.Message
+	ids     []string
+}
+
+// replies : splits the batch message by the requesters
+// The maps without the known id are sent to the first requester with the maps of it.
+func (worker *WorkerImpl) replies(message domain.Message) []reply {
+	if worker.CorrelationKey == "" {
+		return nil
+	}
+
+	replies := []reply{}
+	indexes := [][]int{}
+	positions := map[string]int{}
+	unknown := []int{}
+	for i, m := range message.Unmarshaled() {
+		id, _ := m[worker.CorrelationKey].(string)
+		request, ok := worker.Requests[id]
+		if !ok {
+			unknown = append(unknown, i)
+			continue
+		}
+		position, ok := positions[request.Conn.ID()]
+		if !ok {
+			position = len(replies)
+			positions[request.Conn.ID()] = position
+			replies = append(replies, reply{conn: request.Conn, message: message})
+			indexes = append(indexes, []int{})
+		}
+		replies[position].ids = append(replies[position].ids, id)
+		indexes[position] = append(indexes[position], i)
+	}
+	if len(replies) <= 1 {
+		return replies
+	}
+
+	indexes[0] = append(indexes[0], unknown...)
+	sort.Ints(indexes[0])
+	split := []reply{}
+	for i, r := range replies {
+		subset, err := message.Subset(indexes[i])
+		if err != nil {
+			worker.logger().Warn("failed to split", "error", err)
+			return replies[:1]
+		}
+		split = append(split, reply{conn: r.conn, message: subset, ids: r.ids})
+	}
+	return split
+}
+
+// forget : stops routing the replies to the requests that wait for only one reply
+func (worker *WorkerImpl) forget(ids []string) {
+	for _, id := range ids {
+		request, ok := worker.Requests[id]
+		if !ok || request.Multiple {
+			continue
+		}
+		delete(worker.Requests, id)
+		delete(worker.RequestIDs[request.Conn.ID()], id)
+		if len(worker.RequestIDs[request.Conn.ID()]) == 0 {
+			delete(worker.RequestIDs, request.Conn.ID())
+		}
+	}
+}
+
+// restore : puts back the values of the correlation key that the requester had
+func (worker *WorkerImpl) restore(message domain.Message) domain.Message {
+	restored, err := message.ReplaceField(worker.CorrelationKey, func(value interface{}, ok bool) (interface{}, bool) {
+		id, _ := value.(string)
+		request, found := worker.Requests[id]
+		if !found {
+			return value, ok
+		}
+		return request.Original, request.HasOriginal
+	})
+	if err != nil {
+		worker.logger().Warn("failed to restore", "error", err)
+		return message
+	}
+	return restored
+}
+
+// parseRetainKey : returns nil to disable retaining if the key is empty or invalid
+func (worker *WorkerImpl) parseRetainKey(key string) keyPath {
+	if key == "" {
+		return nil
+	}
+	path, err := parseKeyPath(key)
+	if err != nil {
+		worker.logger().Warn("failed to parse retain key", "error", err)
+		return nil
+	}
+	return path
+}
+
+func (worker *WorkerImpl) retain(channel string, message domain.Message) {
+	if worker.retainPath == nil {
+		return
+	}
+	for _, m := range message.Unmarshaled() {
+		for _, value := range worker.retainPath.Lookup(m) {
+			key, err := json.Marshal(value)
+			if err != nil {
+				continue
+			}
+			if _, ok := worker.Retained[channel]; !ok {
+				worker.Retained[channel] = newRetainedMessages()
+			}
+			worker.Retained[channel].put(string(key), message)
+		}
+	}
+}
+
+func (worker *WorkerImpl) replay(conn domain.Connection) {
+	retained, ok := worker.Retained[conn.Channel()]
+	if !ok || conn.Correlated() || !conn.ReceivesRetained() {
+		return
+	}
+	for _, message := range retained.ordered() {
+		worker.send(conn, message, "replayed")
+	}
+}
+
+// maxRetained : the least recently retained message in the channel is forgotten over this
+const maxRetained = 1000
+
+// retainedMessages : the last message per value of the retain key in the retained order
+type retainedMessages struct {
+	keys     []string
+	messages map[string]domain.Message
+}
+
+func newRetainedMessages() *retainedMessages {
+	return &retainedMessages{
+		messages: make(map[string]domain.Message),
+	}
+}
+
+func (retained *retainedMessages) put(key string, message domain.Message) {
+	if _, ok := retained.messages[key]; ok {
+		retained.remove(key)
+	}
+	retained.keys = append(retained.keys, key)
+	retained.messages[key] = message
+	if len(retained.keys) > maxRetained {
+		retained.remove(retained.keys[0])
+	}
+}
+
+func (retained *retainedMessages) remove(key string) {
+	delete(retained.messages, key)
+	for i, k := range retained.keys {
+		if k == key {
+			retained.keys = append(retained.keys[:i], retained.keys[i+1:]...)
+			return
+		}
+	}
+}
+
+// ordered : returns the distinct messages from the least recently retained
+func (retained *retainedMessages) ordered() []domain.Message {
+	messages := []domain.Message{}
+	added := map[domain.Message]bool{}
+	for _, key := range retained.keys {
+		message := retained.messages[key]
+		if added[message] {
+			continue
+		}
+		added[message] = true
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+func (worker *WorkerImpl) send(conn domain.Connection, message domain.Message, action string) {
+	sent, err := conn.Send(message)
+	switch err {
+	case nil:
+	case internal.ErrDropped:
+		worker.logger().Warn("dropped", connectionLogFields(conn, "dropped", conn.Dropped())...)
+	case internal.ErrOverflow:
+		worker.logger().Warn("disconnected", connectionLogFields(conn, "dropped", conn.Dropped())...)
+		return
+	default:
+		worker.logger().Error("failed to send", connectionLogFields(conn, "error", err)...)
+		return
+	}
+	if sent {
+		worker.logger().Debug(action, connectionLogFields(conn, "size", len(message.Bytes()))...)
+	}
+}
+
+func (worker *WorkerImpl) shutdown() {
+	conns := []domain.Connection{}
+	for _, conn := range worker.Conns {
+		conns = append(conns, conn)
+	}
+
+	// closes in parallel not to wait for the stuck clients one by one
+	closed := make(chan bool)
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn domain.Connection) {
+			defer wg.Done()
+			if err := conn.Shutdown(); err != nil {
+				worker.logger().Error("failed to close", connectionLogFields(conn, "error", err)...)
+			}
+		}(conn)
+	}
+	go func() {
+		wg.Wait()
+		close(closed)
+	}()
+
+	for {
+		select {
+		case err := <-worker.NotifiedSendResult:
+			if err != nil {
+				worker.logger().Error("failed to send", "error", err)
+			}
+		case <-closed:
+			worker.logger().Info("closed", "count", len(conns))
+			return
+		}
+	}
+}
+
+// Add : returns ErrWorkerStopped after the worker stopped
 func (worker *WorkerImpl) Add(conn domain.Connection) error {
-	worker.Joined <- conn
-	return nil
+	select {
+	case worker.Joined <- conn:
+		return nil
+	case <-worker.Stopped:
+		return internal.ErrWorkerStopped
+	}
 }
 
-// Receive :
-func (worker *WorkerImpl) Receive(message domain.Message) error {
-	worker.Received <- message
-	return nil
+// Receive : sends the message to the connections in the channel
+func (worker *WorkerImpl) Receive(channel string, message domain.Message) error {
+	select {
+	case worker.Received <- envelope{channel: channel, message: message}:
+		return nil
+	case <-worker.Stopped:
+		return internal.ErrWorkerStopped
+	}
 }
 
-// Delete :
+// Expect : routes the replies that have the correlation id only to the connection
+// until the first reply, or until it leaves if the request waits for multiple replies
+func (worker *WorkerImpl) Expect(request domain.Request) error {
+	select {
+	case worker.Expected <- request:
+		return nil
+	case <-worker.Stopped:
+		return internal.ErrWorkerStopped
+	}
+}
+
+// Delete : does nothing after the worker stopped
 func (worker *WorkerImpl) Delete(conn domain.Connection) error {
-	worker.Left <- conn
+	select {
+	case worker.Left <- conn:
+	case <-worker.Stopped:
+	}
 	return nil
 }
 
-// NotifySendResult :
+// NotifySendResult : ignores the result after the worker stopped
 func (worker *WorkerImpl) NotifySendResult(err error) {
-	worker.NotifiedSendResult <- err
+	select {
+	case worker.NotifiedSendResult <- err:
+	case <-worker.Stopped:
+	}
 }
 
-// Finish :
+// Finish : closes all the connections and stops the worker
 func (worker *WorkerImpl) Finish() {
-	worker.Done <- true
+	select {
+	case worker.Done <- true:
+	case <-worker.Stopped:
+	}
+}
+
+// ChangeRetainKey : retains by the new key from now and forgets the messages retained by the old key
+func (worker *WorkerImpl) ChangeRetainKey(key string) {
+	select {
+	case worker.RetainKeyChanged <- key:
+	case <-worker.Stopped:
+	}
+}
+
+// Connections : returns the snapshot of the connections by the running worker
+func (worker *WorkerImpl) Connections() []domain.ConnectionInfo {
+	infos := make(chan []domain.ConnectionInfo, 1)
+	select {
+	case worker.Inspected <- infos:
+		return <-infos
+	case <-worker.Stopped:
+		return []domain.ConnectionInfo{}
+	}
 }
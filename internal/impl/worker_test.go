@@ -4,9 +4,13 @@ import (
 	"bytes"
 	"fmt"
 	"log"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/notomo/wsxhub/internal"
 	"github.com/notomo/wsxhub/internal/domain"
 	"github.com/notomo/wsxhub/internal/mock"
 )
@@ -20,30 +24,37 @@ func TestAddDelete(t *testing.T) {
 		FakeID: func() string {
 			return id
 		},
+		FakeChannel: func() string {
+			return ""
+		},
+		FakeRemoteAddress: func() string {
+			return "127.0.0.1:12345"
+		},
+		FakeInfo: func() domain.ConnectionInfo {
+			return domain.ConnectionInfo{ID: id}
+		},
+		FakeShutdown: func() error {
+			return nil
+		},
 	}
 
 	worker := NewWorker("test")
 
+	added := 0
 	go func() {
 		worker.Add(conn)
+		added = len(worker.Connections())
+		worker.Delete(conn)
 		worker.Finish()
 	}()
 	if err := worker.Run(); err != nil {
 		t.Errorf("should not be error: %v", err)
 	}
 
-	if got, want := len(worker.Conns), 1; got != want {
+	if got, want := added, 1; got != want {
 		t.Errorf("want %v, but %v:", want, got)
 	}
 
-	go func() {
-		worker.Delete(conn)
-		worker.Finish()
-	}()
-	if err := worker.Run(); err != nil {
-		t.Errorf("should not be error: %v", err)
-	}
-
 	if got, want := len(worker.Conns), 0; got != want {
 		t.Errorf("want %v, but %v:", want, got)
 	}
@@ -53,7 +64,11 @@ func TestReceive(t *testing.T) {
 	writer := &bytes.Buffer{}
 	log.SetOutput(writer)
 
-	message := &mock.FakeMessage{}
+	message := &mock.FakeMessage{
+		FakeBytes: func() []byte {
+			return []byte("{}")
+		},
+	}
 	id := "1"
 
 	t.Run("ok", func(t *testing.T) {
@@ -61,6 +76,18 @@ func TestReceive(t *testing.T) {
 			FakeID: func() string {
 				return id
 			},
+			FakeChannel: func() string {
+				return ""
+			},
+			FakeRemoteAddress: func() string {
+				return "127.0.0.1:12345"
+			},
+			FakeShutdown: func() error {
+				return nil
+			},
+			FakeCorrelated: func() bool {
+				return false
+			},
 			FakeSend: func(msg domain.Message) (bool, error) {
 				if message != msg {
 					t.Errorf("should be the same message, but actual: %v, %v", message, msg)
@@ -73,7 +100,7 @@ func TestReceive(t *testing.T) {
 
 		go func() {
 			worker.Add(conn)
-			worker.Receive(message)
+			worker.Receive("", message)
 			worker.Finish()
 		}()
 		if err := worker.Run(); err != nil {
@@ -81,11 +108,67 @@ func TestReceive(t *testing.T) {
 		}
 	})
 
+	t.Run("dropped", func(t *testing.T) {
+		writer := &bytes.Buffer{}
+		log.SetOutput(writer)
+
+		conn := &mock.FakeConnection{
+			FakeID: func() string {
+				return id
+			},
+			FakeChannel: func() string {
+				return ""
+			},
+			FakeRemoteAddress: func() string {
+				return "127.0.0.1:12345"
+			},
+			FakeShutdown: func() error {
+				return nil
+			},
+			FakeCorrelated: func() bool {
+				return false
+			},
+			FakeSend: func(msg domain.Message) (bool, error) {
+				return false, internal.ErrDropped
+			},
+			FakeDropped: func() int {
+				return 3
+			},
+		}
+
+		worker := NewWorker("test")
+
+		go func() {
+			worker.Add(conn)
+			worker.Receive("", message)
+			worker.Finish()
+		}()
+		if err := worker.Run(); err != nil {
+			t.Errorf("should not be error: %v", err)
+		}
+
+		if got, want := writer.String(), "WARN (test) dropped connection=1 remote=127.0.0.1:12345 dropped=3"; !strings.Contains(got, want) {
+			t.Errorf("should contain %s, but actual: %s", want, got)
+		}
+	})
+
 	t.Run("fail to send", func(t *testing.T) {
 		conn := &mock.FakeConnection{
 			FakeID: func() string {
 				return id
 			},
+			FakeChannel: func() string {
+				return ""
+			},
+			FakeRemoteAddress: func() string {
+				return "127.0.0.1:12345"
+			},
+			FakeShutdown: func() error {
+				return nil
+			},
+			FakeCorrelated: func() bool {
+				return false
+			},
 			FakeSend: func(msg domain.Message) (bool, error) {
 				if message != msg {
 					t.Errorf("should be the same message, but actual: %v, %v", message, msg)
@@ -98,7 +181,7 @@ func TestReceive(t *testing.T) {
 
 		go func() {
 			worker.Add(conn)
-			worker.Receive(message)
+			worker.Receive("", message)
 			worker.Finish()
 		}()
 		if err := worker.Run(); err != nil {
@@ -145,3 +228,570 @@ func TestNotifySendResult(t *testing.T) {
 		}
 	})
 }
+
+func TestReply(t *testing.T) {
+	writer := &bytes.Buffer{}
+	log.SetOutput(writer)
+
+	id := "requestID"
+	message := &mock.FakeMessage{
+		FakeBytes: func() []byte {
+			return []byte("{}")
+		},
+		FakeUnmarshaled: func() []map[string]interface{} {
+			return []map[string]interface{}{{"id": id}}
+		},
+	}
+	restored := &mock.FakeMessage{
+		FakeBytes: func() []byte {
+			return []byte(`{"id":"1"}`)
+		},
+	}
+	message.FakeReplaceField = func(key string, replace func(interface{}, bool) (interface{}, bool)) (domain.Message, error) {
+		if value, ok := replace(id, true); !ok || value != "1" {
+			t.Errorf("should restore the original id, but actual: %v, %v", value, ok)
+		}
+		return restored, nil
+	}
+
+	replied := 0
+	requester := &mock.FakeConnection{
+		FakeID: func() string {
+			return "1"
+		},
+		FakeChannel: func() string {
+			return ""
+		},
+		FakeRemoteAddress: func() string {
+			return "127.0.0.1:12345"
+		},
+		FakeShutdown: func() error {
+			return nil
+		},
+		FakeCorrelated: func() bool {
+			return true
+		},
+		FakeSend: func(msg domain.Message) (bool, error) {
+			if msg != restored {
+				t.Errorf("should reply the restored message, but actual: %v", msg)
+			}
+			replied++
+			return true, nil
+		},
+	}
+	other := &mock.FakeConnection{
+		FakeID: func() string {
+			return "2"
+		},
+		FakeChannel: func() string {
+			return ""
+		},
+		FakeRemoteAddress: func() string {
+			return "127.0.0.1:12345"
+		},
+		FakeShutdown: func() error {
+			return nil
+		},
+		FakeCorrelated: func() bool {
+			return false
+		},
+		FakeSend: func(msg domain.Message) (bool, error) {
+			t.Errorf("should not send the reply to the other connection")
+			return true, nil
+		},
+	}
+
+	worker := NewWorker("test")
+	worker.CorrelationKey = "id"
+
+	go func() {
+		worker.Add(requester)
+		worker.Add(other)
+		worker.Expect(domain.Request{ID: id, Conn: requester, Original: "1", HasOriginal: true, Multiple: true})
+		worker.Receive("", message)
+		worker.Receive("", message)
+		worker.Delete(requester)
+		worker.Finish()
+	}()
+	if err := worker.Run(); err != nil {
+		t.Errorf("should not be error: %v", err)
+	}
+
+	if got, want := replied, 2; got != want {
+		t.Errorf("should reply to the requester until it leaves, want %v, but %v:", want, got)
+	}
+	if got, want := len(worker.Requests), 0; got != want {
+		t.Errorf("want %v, but %v:", want, got)
+	}
+}
+
+func TestReplyOnce(t *testing.T) {
+	writer := &bytes.Buffer{}
+	log.SetOutput(writer)
+
+	id := "requestID"
+	message := &mock.FakeMessage{
+		FakeBytes: func() []byte {
+			return []byte("{}")
+		},
+		FakeUnmarshaled: func() []map[string]interface{} {
+			return []map[string]interface{}{{"id": id}}
+		},
+	}
+	message.FakeReplaceField = func(key string, replace func(interface{}, bool) (interface{}, bool)) (domain.Message, error) {
+		return message, nil
+	}
+
+	newConnection := func(connID string, correlated bool, sent *int) domain.Connection {
+		return &mock.FakeConnection{
+			FakeID: func() string {
+				return connID
+			},
+			FakeChannel: func() string {
+				return ""
+			},
+			FakeRemoteAddress: func() string {
+				return "127.0.0.1:12345"
+			},
+			FakeShutdown: func() error {
+				return nil
+			},
+			FakeCorrelated: func() bool {
+				return correlated
+			},
+			FakeSend: func(msg domain.Message) (bool, error) {
+				*sent++
+				return true, nil
+			},
+		}
+	}
+	replied := 0
+	requester := newConnection("1", true, &replied)
+	broadcasted := 0
+	other := newConnection("2", false, &broadcasted)
+
+	worker := NewWorker("test")
+	worker.CorrelationKey = "id"
+
+	go func() {
+		worker.Add(requester)
+		worker.Add(other)
+		worker.Expect(domain.Request{ID: id, Conn: requester})
+		worker.Receive("", message)
+		worker.Receive("", message)
+		worker.Finish()
+	}()
+	if err := worker.Run(); err != nil {
+		t.Errorf("should not be error: %v", err)
+	}
+
+	if got, want := replied, 1; got != want {
+		t.Errorf("should route only the first reply, want %v, but %v:", want, got)
+	}
+	if got, want := broadcasted, 1; got != want {
+		t.Errorf("want %v, but %v:", want, got)
+	}
+	if got, want := len(worker.Requests), 0; got != want {
+		t.Errorf("should forget the replied request, want %v, but %v:", want, got)
+	}
+	if got, want := len(worker.RequestIDs), 0; got != want {
+		t.Errorf("want %v, but %v:", want, got)
+	}
+}
+
+func TestReplySplit(t *testing.T) {
+	writer := &bytes.Buffer{}
+	log.SetOutput(writer)
+
+	factory := MessageFactoryImpl{}
+	message, err := factory.FromBytes([]byte(`[{"id":"a"},{"key":"value"},{"id":"b"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newRequester := func(connID string, replies *[]string) domain.Connection {
+		return &mock.FakeConnection{
+			FakeID: func() string {
+				return connID
+			},
+			FakeChannel: func() string {
+				return ""
+			},
+			FakeRemoteAddress: func() string {
+				return "127.0.0.1:12345"
+			},
+			FakeShutdown: func() error {
+				return nil
+			},
+			FakeCorrelated: func() bool {
+				return true
+			},
+			FakeSend: func(msg domain.Message) (bool, error) {
+				*replies = append(*replies, string(msg.Bytes()))
+				return true, nil
+			},
+		}
+	}
+	replies1 := []string{}
+	requester1 := newRequester("1", &replies1)
+	replies2 := []string{}
+	requester2 := newRequester("2", &replies2)
+
+	worker := NewWorker("test")
+	worker.CorrelationKey = "id"
+
+	go func() {
+		worker.Add(requester1)
+		worker.Add(requester2)
+		worker.Expect(domain.Request{ID: "a", Conn: requester1, Original: "1", HasOriginal: true})
+		worker.Expect(domain.Request{ID: "b", Conn: requester2, Original: "2", HasOriginal: true})
+		worker.Receive("", message)
+		worker.Finish()
+	}()
+	if err := worker.Run(); err != nil {
+		t.Errorf("should not be error: %v", err)
+	}
+
+	// the map without the known id goes with the first requester
+	if got, want := fmt.Sprint(replies1), `[[{"id":"1"},{"key":"value"}]]`; got != want {
+		t.Errorf("want %v, but %v:", want, got)
+	}
+	if got, want := fmt.Sprint(replies2), `[[{"id":"2"}]]`; got != want {
+		t.Errorf("want %v, but %v:", want, got)
+	}
+}
+
+func TestRetain(t *testing.T) {
+	writer := &bytes.Buffer{}
+	log.SetOutput(writer)
+
+	type S = map[string]interface{}
+	newMessage := func(uri string) domain.Message {
+		return &mock.FakeMessage{
+			FakeBytes: func() []byte {
+				return []byte("{}")
+			},
+			FakeUnmarshaled: func() []map[string]interface{} {
+				return []S{{"params": S{"uri": uri}}}
+			},
+		}
+	}
+	oldMessage := newMessage("file:///a")
+	lastMessage := newMessage("file:///a")
+	otherMessage := newMessage("file:///b")
+
+	newConnection := func(receivesRetained bool, replayed *[]domain.Message) domain.Connection {
+		return &mock.FakeConnection{
+			FakeID: func() string {
+				return fmt.Sprintf("%p", replayed)
+			},
+			FakeChannel: func() string {
+				return ""
+			},
+			FakeRemoteAddress: func() string {
+				return "127.0.0.1:12345"
+			},
+			FakeShutdown: func() error {
+				return nil
+			},
+			FakeCorrelated: func() bool {
+				return false
+			},
+			FakeReceivesRetained: func() bool {
+				return receivesRetained
+			},
+			FakeSend: func(msg domain.Message) (bool, error) {
+				*replayed = append(*replayed, msg)
+				return true, nil
+			},
+		}
+	}
+	replayed := []domain.Message{}
+	conn := newConnection(true, &replayed)
+	skipped := []domain.Message{}
+	skippingConn := newConnection(false, &skipped)
+
+	worker := NewWorker("test")
+	worker.RetainKey = "params.uri"
+
+	go func() {
+		worker.Receive("", oldMessage)
+		worker.Receive("", lastMessage)
+		worker.Receive("", otherMessage)
+		worker.Add(conn)
+		worker.Add(skippingConn)
+		worker.Finish()
+	}()
+	if err := worker.Run(); err != nil {
+		t.Errorf("should not be error: %v", err)
+	}
+
+	// in the retained order without the overwritten message
+	want := []domain.Message{lastMessage, otherMessage}
+	if !sameMessages(replayed, want) {
+		t.Errorf("want %v, but %v:", want, replayed)
+	}
+	if got, want := len(skipped), 0; got != want {
+		t.Errorf("want %v, but %v:", want, got)
+	}
+}
+
+func sameMessages(got []domain.Message, want []domain.Message) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRetainedMessages(t *testing.T) {
+	newMessage := func() domain.Message {
+		return &mock.FakeMessage{}
+	}
+
+	t.Run("order", func(t *testing.T) {
+		a := newMessage()
+		b := newMessage()
+		lastA := newMessage()
+		retained := newRetainedMessages()
+		retained.put("a", a)
+		retained.put("b", b)
+		retained.put("a", lastA)
+
+		want := []domain.Message{b, lastA}
+		if got := retained.ordered(); !sameMessages(got, want) {
+			t.Errorf("want %v, but %v:", want, got)
+		}
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		first := newMessage()
+		retained := newRetainedMessages()
+		retained.put("first", first)
+		for i := 0; i < maxRetained; i++ {
+			retained.put(fmt.Sprint(i), newMessage())
+		}
+
+		if got, want := len(retained.messages), maxRetained; got != want {
+			t.Errorf("want %v, but %v:", want, got)
+		}
+		if _, ok := retained.messages["first"]; ok {
+			t.Errorf("should forget the least recently retained message")
+		}
+	})
+}
+
+func TestFinish(t *testing.T) {
+	writer := &bytes.Buffer{}
+	log.SetOutput(writer)
+
+	shutdown := 0
+	conn := &mock.FakeConnection{
+		FakeID: func() string {
+			return "1"
+		},
+		FakeChannel: func() string {
+			return ""
+		},
+		FakeRemoteAddress: func() string {
+			return "127.0.0.1:12345"
+		},
+		FakeShutdown: func() error {
+			shutdown++
+			return nil
+		},
+	}
+
+	worker := NewWorker("test")
+
+	go func() {
+		worker.Add(conn)
+		worker.Finish()
+	}()
+	if err := worker.Run(); err != nil {
+		t.Errorf("should not be error: %v", err)
+	}
+
+	if got, want := shutdown, 1; got != want {
+		t.Errorf("want %v, but %v:", want, got)
+	}
+
+	// the connections and the timers can call the stopped worker
+	if err := worker.Add(conn); err != internal.ErrWorkerStopped {
+		t.Errorf("want error %v, but %v:", internal.ErrWorkerStopped, err)
+	}
+	if err := worker.Receive("", &mock.FakeMessage{}); err != internal.ErrWorkerStopped {
+		t.Errorf("want error %v, but %v:", internal.ErrWorkerStopped, err)
+	}
+	if err := worker.Delete(conn); err != nil {
+		t.Errorf("should not be error: %v", err)
+	}
+	worker.NotifySendResult(nil)
+	worker.Finish()
+}
+
+func TestFinishParallel(t *testing.T) {
+	writer := &bytes.Buffer{}
+	log.SetOutput(writer)
+
+	worker := NewWorker("test")
+
+	// each shutdown waits for the other to start
+	var arrived sync.WaitGroup
+	arrived.Add(2)
+	all := make(chan bool)
+	go func() {
+		arrived.Wait()
+		close(all)
+	}()
+	parallel := true
+	newConn := func(id string) domain.Connection {
+		return &mock.FakeConnection{
+			FakeID: func() string {
+				return id
+			},
+			FakeChannel: func() string {
+				return ""
+			},
+			FakeRemoteAddress: func() string {
+				return "127.0.0.1:12345"
+			},
+			FakeShutdown: func() error {
+				arrived.Done()
+				select {
+				case <-all:
+				case <-time.After(1 * time.Second):
+					parallel = false
+				}
+				return nil
+			},
+		}
+	}
+
+	go func() {
+		worker.Add(newConn("1"))
+		worker.Add(newConn("2"))
+		worker.Finish()
+	}()
+	if err := worker.Run(); err != nil {
+		t.Errorf("should not be error: %v", err)
+	}
+
+	if !parallel {
+		t.Errorf("should shut down the connections in parallel")
+	}
+}
+
+func TestChannel(t *testing.T) {
+	writer := &bytes.Buffer{}
+	log.SetOutput(writer)
+
+	message := &mock.FakeMessage{
+		FakeBytes: func() []byte {
+			return []byte("{}")
+		},
+	}
+
+	newConnection := func(id string, channel string, received *int) domain.Connection {
+		return &mock.FakeConnection{
+			FakeID: func() string {
+				return id
+			},
+			FakeChannel: func() string {
+				return channel
+			},
+			FakeRemoteAddress: func() string {
+				return "127.0.0.1:12345"
+			},
+			FakeCorrelated: func() bool {
+				return false
+			},
+			FakeShutdown: func() error {
+				return nil
+			},
+			FakeSend: func(msg domain.Message) (bool, error) {
+				*received++
+				return true, nil
+			},
+		}
+	}
+	neovimReceived := 0
+	neovimConn := newConnection("1", "neovim", &neovimReceived)
+	vscodeReceived := 0
+	vscodeConn := newConnection("2", "vscode", &vscodeReceived)
+
+	worker := NewWorker("test")
+
+	go func() {
+		worker.Add(neovimConn)
+		worker.Add(vscodeConn)
+		worker.Receive("neovim", message)
+		worker.Receive("", message)
+		worker.Delete(vscodeConn)
+		worker.Finish()
+	}()
+	if err := worker.Run(); err != nil {
+		t.Errorf("should not be error: %v", err)
+	}
+
+	if got, want := neovimReceived, 1; got != want {
+		t.Errorf("want %v, but %v:", want, got)
+	}
+	if got, want := vscodeReceived, 0; got != want {
+		t.Errorf("want %v, but %v:", want, got)
+	}
+	if got, want := len(worker.Channels), 1; got != want {
+		t.Errorf("want %v, but %v:", want, got)
+	}
+}
+
+func TestConnections(t *testing.T) {
+	writer := &bytes.Buffer{}
+	log.SetOutput(writer)
+
+	now := time.Now()
+	newConnection := func(id string, connectedAt time.Time) domain.Connection {
+		return &mock.FakeConnection{
+			FakeID: func() string {
+				return id
+			},
+			FakeChannel: func() string {
+				return ""
+			},
+			FakeRemoteAddress: func() string {
+				return "127.0.0.1:12345"
+			},
+			FakeShutdown: func() error {
+				return nil
+			},
+			FakeInfo: func() domain.ConnectionInfo {
+				return domain.ConnectionInfo{ID: id, ConnectedAt: connectedAt}
+			},
+		}
+	}
+
+	worker := NewWorker("test")
+
+	var got []domain.ConnectionInfo
+	go func() {
+		worker.Add(newConnection("2", now.Add(time.Second)))
+		worker.Add(newConnection("1", now))
+		got = worker.Connections()
+		worker.Finish()
+	}()
+	if err := worker.Run(); err != nil {
+		t.Errorf("should not be error: %v", err)
+	}
+
+	want := []domain.ConnectionInfo{
+		{Side: "test", ID: "1", ConnectedAt: now},
+		{Side: "test", ID: "2", ConnectedAt: now.Add(time.Second)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, but %v:", want, got)
+	}
+}
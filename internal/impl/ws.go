@@ -1,10 +1,13 @@
 package impl
 
 import (
-	"errors"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io/ioutil"
 	"net"
+	"net/http"
 	"net/url"
 	"strconv"
 	"time"
@@ -14,19 +17,72 @@ import (
 	"github.com/notomo/wsxhub/internal/domain"
 )
 
+const closeTimeout = 1 * time.Second
+
 // WebsocketClientFactoryImpl :
 type WebsocketClientFactoryImpl struct {
-	Port         string
-	FilterSource string
-	Debounce     int
+	Port            string
+	Channel         string
+	FilterSource    string
+	TransformSource string
+	Debounce        int
+	Correlate       bool
+	MultipleReplies bool
+	SkipRetained    bool
+	TLS             bool
+	CACertFile      string
+	Token           string
+	SocketPath      string
+	ConnectTimeout  time.Duration
+	WriteTimeout    time.Duration
 }
 
-// Client :
+// Client : returns InputError without connecting if the filter or the transform is invalid
 func (factory *WebsocketClientFactoryImpl) Client() (domain.WebsocketClient, error) {
-	params := url.Values{"filter": {factory.FilterSource}, "debounce": {strconv.Itoa(factory.Debounce)}}
-	u := fmt.Sprintf("ws://localhost:%s/?%s", factory.Port, params.Encode())
-	ws, resp, wsErr := websocket.DefaultDialer.Dial(u, nil)
+	if err := factory.validate(); err != nil {
+		return nil, &internal.InputError{Err: err}
+	}
+
+	params := url.Values{
+		"filter":    {factory.FilterSource},
+		"transform": {factory.TransformSource},
+		"debounce":  {strconv.Itoa(factory.Debounce)},
+		"correlate": {strconv.FormatBool(factory.Correlate)},
+		"multiple":  {strconv.FormatBool(factory.MultipleReplies)},
+		"retained":  {strconv.FormatBool(!factory.SkipRetained)},
+	}
+	path := "/"
+	if factory.Channel != "" {
+		path = domain.ChannelPathPrefix + url.PathEscape(factory.Channel)
+	}
+	scheme := "ws"
+	if factory.TLS {
+		scheme = "wss"
+	}
+	host := "localhost:" + factory.Port
+	if factory.SocketPath != "" {
+		host = "localhost"
+	}
+	u := fmt.Sprintf("%s://%s%s?%s", scheme, host, path, params.Encode())
+
+	dialer, err := factory.dialer()
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	if factory.Token != "" {
+		header.Set("Authorization", "Bearer "+factory.Token)
+	}
+
+	ws, resp, wsErr := dialer.Dial(u, header)
 	if wsErr != nil {
+		if isTimeout(wsErr) {
+			return nil, internal.ErrConnectTimeout
+		}
+		if opErr, ok := wsErr.(*net.OpError); ok && opErr.Op == "dial" {
+			return nil, &internal.ConnectionError{Err: wsErr}
+		}
 		if resp == nil {
 			return nil, wsErr
 		}
@@ -36,37 +92,106 @@ func (factory *WebsocketClientFactoryImpl) Client() (domain.WebsocketClient, err
 			return nil, wsErr
 		}
 
-		msg := fmt.Sprintf("%s: %s", wsErr, body)
-		return nil, errors.New(msg)
+		return nil, &internal.HandshakeError{
+			StatusCode: resp.StatusCode,
+			Body:       string(body),
+			Err:        wsErr,
+		}
 	}
 
 	return &WebsocketClientImpl{
-		ws: ws,
+		ws:           ws,
+		writeTimeout: factory.WriteTimeout,
+		dialed:       true,
 	}, nil
 }
 
+// validate : the server rejects the same sources by the handshake
+func (factory *WebsocketClientFactoryImpl) validate() error {
+	if _, err := (&FilterClauseFactoryImpl{}).FilterClause(factory.FilterSource); err != nil {
+		return fmt.Errorf("invalid filter: %s", err)
+	}
+	if _, err := (&TransformerFactoryImpl{}).Transformer(factory.TransformSource); err != nil {
+		return fmt.Errorf("invalid transform: %s", err)
+	}
+	return nil
+}
+
+func (factory *WebsocketClientFactoryImpl) dialer() (*websocket.Dialer, error) {
+	dialer := *websocket.DefaultDialer
+	if factory.ConnectTimeout > 0 {
+		dialer.HandshakeTimeout = factory.ConnectTimeout
+	}
+	if factory.SocketPath != "" {
+		dialer.NetDial = func(string, string) (net.Conn, error) {
+			return net.Dial("unix", factory.SocketPath)
+		}
+	}
+	if factory.CACertFile == "" {
+		return &dialer, nil
+	}
+
+	pem, err := ioutil.ReadFile(factory.CACertFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", factory.CACertFile)
+	}
+	dialer.TLSClientConfig = &tls.Config{
+		RootCAs: pool,
+	}
+	return &dialer, nil
+}
+
 // WebsocketClientImpl :
 type WebsocketClientImpl struct {
-	ws *websocket.Conn
+	ws           *websocket.Conn
+	writeTimeout time.Duration
+	// dialed : the client side reports the abnormal close and closes normally,
+	// but the server side treats any close as EOF
+	dialed bool
 }
 
 // Send :
 func (client *WebsocketClientImpl) Send(message []byte) error {
-	return client.ws.WriteMessage(websocket.TextMessage, message)
+	if client.writeTimeout > 0 {
+		client.ws.SetWriteDeadline(time.Now().Add(client.writeTimeout))
+	}
+	if err := client.ws.WriteMessage(websocket.TextMessage, message); err != nil {
+		if isTimeout(err) {
+			return internal.ErrWriteTimeout
+		}
+		return err
+	}
+	return nil
+}
+
+// SendClose : sends a close frame with the status code and the reason
+func (client *WebsocketClientImpl) SendClose(code int, reason string) error {
+	message := websocket.FormatCloseMessage(code, reason)
+	return client.ws.WriteControl(websocket.CloseMessage, message, time.Now().Add(closeTimeout))
 }
 
-// ReceiveOnce :
-func (client *WebsocketClientImpl) ReceiveOnce(timeout int) ([]byte, error) {
+// ReceiveOnce : waits without timeout if the timeout is 0
+// On the client side, returns ErrEOF if the server closes normally or shuts down, and CloseError for the other close codes.
+func (client *WebsocketClientImpl) ReceiveOnce(timeout time.Duration) ([]byte, error) {
+	deadline := time.Time{}
 	if timeout > 0 {
-		client.ws.SetReadDeadline(time.Now().Add(time.Duration(timeout) * time.Second))
+		deadline = time.Now().Add(timeout)
 	}
+	client.ws.SetReadDeadline(deadline)
 
 	_, message, err := client.ws.ReadMessage()
 	if err != nil {
-		if operr, ok := err.(*net.OpError); ok && operr.Timeout() {
+		if isTimeout(err) {
 			return nil, internal.ErrTimeout
-		} else if _, ok := err.(*websocket.CloseError); ok {
-			return nil, internal.ErrEOF
+		} else if closeErr, ok := err.(*websocket.CloseError); ok {
+			if !client.dialed || closeErr.Code == websocket.CloseNormalClosure || closeErr.Code == websocket.CloseGoingAway {
+				return nil, internal.ErrEOF
+			}
+			return nil, &internal.CloseError{Code: closeErr.Code, Reason: closeErr.Text}
 		}
 		return nil, err
 	}
@@ -75,7 +200,7 @@ func (client *WebsocketClientImpl) ReceiveOnce(timeout int) ([]byte, error) {
 }
 
 // Receive :
-func (client *WebsocketClientImpl) Receive(timeout int, callback func([]byte) error) error {
+func (client *WebsocketClientImpl) Receive(timeout time.Duration, callback func([]byte) error) error {
 	for {
 		message, err := client.ReceiveOnce(timeout)
 		if err == internal.ErrEOF {
@@ -90,7 +215,20 @@ func (client *WebsocketClientImpl) Receive(timeout int, callback func([]byte) er
 	}
 }
 
-// Close :
+// Close : sends the normal close frame before closing on the client side not to be logged as the abnormal close
 func (client *WebsocketClientImpl) Close() error {
+	if client.dialed {
+		message := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+		// fails if the close frame was already sent or the connection was closed
+		client.ws.WriteControl(websocket.CloseMessage, message, time.Now().Add(closeTimeout))
+	}
 	return client.ws.Close()
 }
+
+func isTimeout(err error) bool {
+	if err == context.DeadlineExceeded {
+		return true
+	}
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
@@ -0,0 +1,25 @@
+package mock
+
+import "github.com/notomo/wsxhub/internal/domain"
+
+// FakeConfigFactory :
+type FakeConfigFactory struct {
+	domain.ConfigFactory
+	FakeConfig func(string) (*domain.Config, error)
+}
+
+// Config :
+func (factory *FakeConfigFactory) Config(path string) (*domain.Config, error) {
+	return factory.FakeConfig(path)
+}
+
+// FakeConfigReloader :
+type FakeConfigReloader struct {
+	domain.ConfigReloader
+	FakeReload func() error
+}
+
+// Reload :
+func (reloader *FakeConfigReloader) Reload() error {
+	return reloader.FakeReload()
+}
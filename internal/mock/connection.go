@@ -7,8 +7,15 @@ import (
 // FakeConnection :
 type FakeConnection struct {
 	domain.Connection
-	FakeID   func() string
-	FakeSend func(domain.Message) (bool, error)
+	FakeID               func() string
+	FakeChannel          func() string
+	FakeRemoteAddress    func() string
+	FakeSend             func(domain.Message) (bool, error)
+	FakeCorrelated       func() bool
+	FakeReceivesRetained func() bool
+	FakeDropped          func() int
+	FakeShutdown         func() error
+	FakeInfo             func() domain.ConnectionInfo
 }
 
 // ID :
@@ -20,3 +27,38 @@ func (conn *FakeConnection) ID() string {
 func (conn *FakeConnection) Send(message domain.Message) (bool, error) {
 	return conn.FakeSend(message)
 }
+
+// Correlated :
+func (conn *FakeConnection) Correlated() bool {
+	return conn.FakeCorrelated()
+}
+
+// ReceivesRetained :
+func (conn *FakeConnection) ReceivesRetained() bool {
+	return conn.FakeReceivesRetained()
+}
+
+// Dropped :
+func (conn *FakeConnection) Dropped() int {
+	return conn.FakeDropped()
+}
+
+// Shutdown :
+func (conn *FakeConnection) Shutdown() error {
+	return conn.FakeShutdown()
+}
+
+// Channel :
+func (conn *FakeConnection) Channel() string {
+	return conn.FakeChannel()
+}
+
+// RemoteAddress :
+func (conn *FakeConnection) RemoteAddress() string {
+	return conn.FakeRemoteAddress()
+}
+
+// Info :
+func (conn *FakeConnection) Info() domain.ConnectionInfo {
+	return conn.FakeInfo()
+}
@@ -0,0 +1,40 @@
+package mock
+
+import (
+	"github.com/notomo/wsxhub/internal/domain"
+)
+
+// FakeLogger :
+type FakeLogger struct {
+	domain.Logger
+	FakeLog func(level string, msg string, keyValues ...interface{})
+}
+
+// Debug :
+func (logger *FakeLogger) Debug(msg string, keyValues ...interface{}) {
+	logger.FakeLog("debug", msg, keyValues...)
+}
+
+// Info :
+func (logger *FakeLogger) Info(msg string, keyValues ...interface{}) {
+	logger.FakeLog("info", msg, keyValues...)
+}
+
+// Warn :
+func (logger *FakeLogger) Warn(msg string, keyValues ...interface{}) {
+	logger.FakeLog("warn", msg, keyValues...)
+}
+
+// Error :
+func (logger *FakeLogger) Error(msg string, keyValues ...interface{}) {
+	logger.FakeLog("error", msg, keyValues...)
+}
+
+// With :
+func (logger *FakeLogger) With(keyValues ...interface{}) domain.Logger {
+	return &FakeLogger{
+		FakeLog: func(level string, msg string, kvs ...interface{}) {
+			logger.FakeLog(level, msg, append(append([]interface{}{}, keyValues...), kvs...)...)
+		},
+	}
+}
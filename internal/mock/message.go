@@ -11,6 +11,7 @@ type FakeMessageFactory struct {
 	domain.MessageFactory
 	FakeFromReader func(io.Reader) (domain.Message, error)
 	FakeFromBytes  func([]byte) (domain.Message, error)
+	FakeFromStream func(io.Reader, func(domain.Message, error) error) error
 }
 
 // FromReader :
@@ -23,11 +24,19 @@ func (factory *FakeMessageFactory) FromBytes(bytes []byte) (domain.Message, erro
 	return factory.FakeFromBytes(bytes)
 }
 
+// FromStream :
+func (factory *FakeMessageFactory) FromStream(inputReader io.Reader, callback func(domain.Message, error) error) error {
+	return factory.FakeFromStream(inputReader, callback)
+}
+
 // FakeMessage :
 type FakeMessage struct {
 	domain.Message
-	FakeBytes       func() []byte
-	FakeUnmarshaled func() []map[string]interface{}
+	FakeBytes        func() []byte
+	FakeUnmarshaled  func() []map[string]interface{}
+	FakeReplaceField func(string, func(interface{}, bool) (interface{}, bool)) (domain.Message, error)
+	FakeBatch        func() bool
+	FakeSubset       func([]int) (domain.Message, error)
 }
 
 // Bytes :
@@ -39,3 +48,18 @@ func (factory *FakeMessage) Bytes() []byte {
 func (factory *FakeMessage) Unmarshaled() []map[string]interface{} {
 	return factory.FakeUnmarshaled()
 }
+
+// ReplaceField :
+func (factory *FakeMessage) ReplaceField(key string, replace func(interface{}, bool) (interface{}, bool)) (domain.Message, error) {
+	return factory.FakeReplaceField(key, replace)
+}
+
+// Batch :
+func (factory *FakeMessage) Batch() bool {
+	return factory.FakeBatch()
+}
+
+// Subset :
+func (factory *FakeMessage) Subset(indexes []int) (domain.Message, error) {
+	return factory.FakeSubset(indexes)
+}
@@ -0,0 +1,42 @@
+package mock
+
+import "github.com/notomo/wsxhub/internal/domain"
+
+// FakeServerFactory :
+type FakeServerFactory struct {
+	domain.ServerFactory
+	FakeServer func(...domain.Route) (domain.Server, error)
+}
+
+// Server :
+func (factory *FakeServerFactory) Server(routes ...domain.Route) (domain.Server, error) {
+	return factory.FakeServer(routes...)
+}
+
+// FakeAdminServerFactory :
+type FakeAdminServerFactory struct {
+	domain.AdminServerFactory
+	FakeServer func() (domain.Server, error)
+}
+
+// Server :
+func (factory *FakeAdminServerFactory) Server() (domain.Server, error) {
+	return factory.FakeServer()
+}
+
+// FakeServer :
+type FakeServer struct {
+	domain.Server
+	FakeStart    func() error
+	FakeShutdown func() error
+}
+
+// Start :
+func (server *FakeServer) Start() error {
+	return server.FakeStart()
+}
+
+// Shutdown :
+func (server *FakeServer) Shutdown() error {
+	return server.FakeShutdown()
+}
@@ -0,0 +1,14 @@
+package mock
+
+import "github.com/notomo/wsxhub/internal/domain"
+
+// FakeTransformer :
+type FakeTransformer struct {
+	domain.Transformer
+	FakeTransform func(domain.Message) ([][]byte, error)
+}
+
+// Transform :
+func (transformer *FakeTransformer) Transform(message domain.Message) ([][]byte, error) {
+	return transformer.FakeTransform(message)
+}
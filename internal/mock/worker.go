@@ -7,8 +7,10 @@ type FakeWorker struct {
 	domain.Worker
 	FakeDelete           func(domain.Connection) error
 	FakeAdd              func(domain.Connection) error
-	FakeReceive          func(domain.Message) error
+	FakeReceive          func(string, domain.Message) error
 	FakeNotifySendResult func(error)
+	FakeExpect           func(domain.Request) error
+	FakeConnections      func() []domain.ConnectionInfo
 }
 
 // Delete :
@@ -22,11 +24,21 @@ func (factory *FakeWorker) Add(connection domain.Connection) error {
 }
 
 // Receive :
-func (factory *FakeWorker) Receive(message domain.Message) error {
-	return factory.FakeReceive(message)
+func (factory *FakeWorker) Receive(channel string, message domain.Message) error {
+	return factory.FakeReceive(channel, message)
 }
 
 // NotifySendResult :
 func (factory *FakeWorker) NotifySendResult(err error) {
 	factory.FakeNotifySendResult(err)
 }
+
+// Expect :
+func (factory *FakeWorker) Expect(request domain.Request) error {
+	return factory.FakeExpect(request)
+}
+
+// Connections :
+func (factory *FakeWorker) Connections() []domain.ConnectionInfo {
+	return factory.FakeConnections()
+}
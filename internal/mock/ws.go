@@ -1,6 +1,10 @@
 package mock
 
-import "github.com/notomo/wsxhub/internal/domain"
+import (
+	"time"
+
+	"github.com/notomo/wsxhub/internal/domain"
+)
 
 // FakeWebsocketClientFactory :
 type FakeWebsocketClientFactory struct {
@@ -18,8 +22,9 @@ type FakeWebsocketClient struct {
 	domain.WebsocketClient
 	FakeSend        func([]byte) error
 	FakeClose       func() error
-	FakeReceive     func(int, func([]byte) error) error
-	FakeReceiveOnce func(int) ([]byte, error)
+	FakeReceive     func(time.Duration, func([]byte) error) error
+	FakeReceiveOnce func(time.Duration) ([]byte, error)
+	FakeSendClose   func(int, string) error
 }
 
 // Send :
@@ -33,11 +38,16 @@ func (factory *FakeWebsocketClient) Close() error {
 }
 
 // Receive :
-func (factory *FakeWebsocketClient) Receive(timeout int, callback func([]byte) error) error {
+func (factory *FakeWebsocketClient) Receive(timeout time.Duration, callback func([]byte) error) error {
 	return factory.FakeReceive(timeout, callback)
 }
 
 // ReceiveOnce :
-func (factory *FakeWebsocketClient) ReceiveOnce(timeout int) ([]byte, error) {
+func (factory *FakeWebsocketClient) ReceiveOnce(timeout time.Duration) ([]byte, error) {
 	return factory.FakeReceiveOnce(timeout)
 }
+
+// SendClose :
+func (factory *FakeWebsocketClient) SendClose(code int, reason string) error {
+	return factory.FakeSendClose(code, reason)
+}
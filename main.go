@@ -1,14 +1,164 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
+	"github.com/notomo/wsxhub/internal"
 	"github.com/notomo/wsxhub/internal/command"
+	"github.com/notomo/wsxhub/internal/domain"
 	"github.com/notomo/wsxhub/internal/impl"
 	"github.com/urfave/cli"
 )
 
+var channelFlag = cli.StringFlag{
+	Name:  "channel",
+	Usage: "Channel name to exchange messages (the default channel if empty)",
+}
+
+var streamFlag = cli.BoolFlag{
+	Name:  "stream",
+	Usage: "Send each newline delimited or concatenated json in stdin as it arrives over one connection",
+}
+
+// durationValue : accepts a duration like `500ms` or `2s`, or integer seconds like `2`
+type durationValue struct {
+	duration time.Duration
+}
+
+func (value *durationValue) Set(s string) error {
+	if seconds, err := strconv.Atoi(s); err == nil {
+		value.duration = time.Duration(seconds) * time.Second
+	} else if value.duration, err = time.ParseDuration(s); err != nil {
+		return fmt.Errorf("invalid duration: %s", s)
+	}
+	if value.duration < 0 {
+		return fmt.Errorf("negative duration: %s", s)
+	}
+	return nil
+}
+
+func (value *durationValue) String() string {
+	return value.duration.String()
+}
+
+func durationFlag(name string, usage string) cli.GenericFlag {
+	return cli.GenericFlag{
+		Name:  name,
+		Usage: usage,
+		Value: &durationValue{},
+	}
+}
+
+func duration(value interface{}) time.Duration {
+	if d, ok := value.(*durationValue); ok {
+		return d.duration
+	}
+	return 0
+}
+
+// errorFormatValue : validates --error-format on parsing to use it after the command failed
+type errorFormatValue struct {
+	format command.ErrorFormat
+}
+
+func (value *errorFormatValue) Set(s string) error {
+	format, err := command.ParseErrorFormat(s)
+	if err != nil {
+		return err
+	}
+	value.format = format
+	return nil
+}
+
+func (value *errorFormatValue) String() string {
+	return string(value.format)
+}
+
+var errorFormat = &errorFormatValue{format: command.ErrorFormatText}
+
+// usageError : exits with the bad input code for the invalid flags
+func usageError(context *cli.Context, err error, isSubcommand bool) error {
+	return &internal.InputError{Err: err}
+}
+
+func websocketClientFactory(context *cli.Context) (*impl.WebsocketClientFactoryImpl, error) {
+	token, err := impl.ReadToken(context.GlobalString("token-file"), "WSXHUB_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+	return &impl.WebsocketClientFactoryImpl{
+		Port:           context.GlobalString("port"),
+		TLS:            context.GlobalBool("tls") || context.GlobalString("ca-cert") != "",
+		CACertFile:     context.GlobalString("ca-cert"),
+		Token:          token,
+		SocketPath:     context.GlobalString("socket"),
+		ConnectTimeout: duration(context.GlobalGeneric("connect-timeout")),
+		WriteTimeout:   duration(context.GlobalGeneric("write-timeout")),
+	}, nil
+}
+
+// overrideConfig : the flags given explicitly take precedence over the config file
+func overrideConfig(context *cli.Context, config *domain.Config) {
+	if context.IsSet("inside-listen") || context.IsSet("inside-socket") {
+		config.Inside.Listen = context.StringSlice("inside-listen")
+		if socket := context.String("inside-socket"); socket != "" {
+			config.Inside.Listen = append(config.Inside.Listen, socket)
+		}
+	} else if context.GlobalIsSet("port") {
+		config.Inside.Listen = []string{":" + context.GlobalString("port")}
+	}
+	if context.IsSet("outside-listen") {
+		config.Outside.Listen = context.StringSlice("outside-listen")
+	} else if context.IsSet("outside") {
+		config.Outside.Listen = []string{":" + context.String("outside")}
+	}
+
+	stringFlags := map[string]*string{
+		"outside-allow":      &config.Outside.Allow,
+		"tls-cert":           &config.Outside.TLSCert,
+		"tls-key":            &config.Outside.TLSKey,
+		"outside-token-file": &config.Outside.TokenFile,
+		"inside-tls-cert":    &config.Inside.TLSCert,
+		"inside-tls-key":     &config.Inside.TLSKey,
+		"inside-token-file":  &config.Inside.TokenFile,
+		"admin-token-file":   &config.Admin.TokenFile,
+		"correlation-key":    &config.CorrelationKey,
+		"retain-key":         &config.RetainKey,
+	}
+	for name, value := range stringFlags {
+		if context.IsSet(name) {
+			*value = context.String(name)
+		}
+	}
+	if context.IsSet("admin-listen") {
+		config.Admin.Listen = context.StringSlice("admin-listen")
+	}
+	if context.IsSet("outside-allow-origin") {
+		config.Outside.AllowOrigins = context.StringSlice("outside-allow-origin")
+	}
+	if context.IsSet("send-queue-size") {
+		config.SendQueueSize = context.Int("send-queue-size")
+	}
+	if context.IsSet("send-queue-policy") {
+		config.SendQueuePolicy = domain.OverflowPolicy(context.String("send-queue-policy"))
+	}
+	if context.IsSet("max-message-size") {
+		config.MaxMessageSize = context.Int64("max-message-size")
+	}
+	if context.IsSet("max-message-depth") {
+		config.MaxMessageDepth = context.Int("max-message-depth")
+	}
+	if context.IsSet("max-batch-length") {
+		config.MaxBatchLength = context.Int("max-batch-length")
+	}
+}
+
 func main() {
 	app := cli.NewApp()
 
@@ -21,6 +171,29 @@ func main() {
 			Usage: "Set port",
 			Value: "8002",
 		},
+		cli.BoolFlag{
+			Name:  "tls",
+			Usage: "Connect by wss://",
+		},
+		cli.StringFlag{
+			Name:  "ca-cert",
+			Usage: "CA certificate file to trust (implies --tls)",
+		},
+		cli.StringFlag{
+			Name:  "token-file",
+			Usage: "file that contains the token to connect (default: $WSXHUB_TOKEN)",
+		},
+		cli.StringFlag{
+			Name:  "socket",
+			Usage: "unix socket path of inside to connect instead of --port",
+		},
+		durationFlag("connect-timeout", "Timeout like 500ms or 2s for connecting including the handshake (no timeout if 0)"),
+		durationFlag("write-timeout", "Timeout like 500ms or 2s for sending each message (no timeout if 0)"),
+		cli.GenericFlag{
+			Name:  "error-format",
+			Usage: "Error output format to stderr: text, json (exit codes are the same)",
+			Value: errorFormat,
+		},
 	}
 
 	app.Commands = []cli.Command{
@@ -28,16 +201,38 @@ func main() {
 			Name:  "send",
 			Usage: "Send a request and wait result",
 			Action: func(context *cli.Context) error {
+				factory, err := websocketClientFactory(context)
+				if err != nil {
+					return err
+				}
+				factory.Channel = context.String("channel")
+				factory.FilterSource = context.String("filter")
+				factory.Correlate = true
 				cmd := command.SendCommand{
-					WebsocketClientFactory: &impl.WebsocketClientFactoryImpl{
-						Port:         context.GlobalString("port"),
-						FilterSource: context.String("filter"),
-					},
-					OutputWriter:   os.Stdout,
-					Timeout:        context.Int("timeout"),
-					MessageFactory: &impl.MessageFactoryImpl{},
-					InputReader:    os.Stdin,
+					WebsocketClientFactory: factory,
+					OutputWriter:           os.Stdout,
+					Timeout:                duration(context.Generic("timeout")),
+					MessageFactory:         &impl.MessageFactoryImpl{},
+					InputReader:            os.Stdin,
+					Stream:                 context.Bool("stream"),
+					ErrorWriter:            os.Stderr,
+					Count:                  context.Int("count"),
+					IdleTimeout:            duration(context.Generic("idle-timeout")),
+				}
+				if until := context.String("until"); until != "" {
+					filterClause, err := (&impl.FilterClauseFactoryImpl{}).FilterClause(until)
+					if err != nil {
+						return &internal.InputError{Err: err}
+					}
+					cmd.UntilFilterClause = filterClause
+				}
+				if context.IsSet("count") && cmd.Count == 0 {
+					return &internal.InputError{Err: errors.New("count must not be 0")}
+				}
+				if !context.IsSet("count") && (context.IsSet("until") || context.IsSet("idle-timeout")) {
+					cmd.Count = -1
 				}
+				factory.MultipleReplies = cmd.MultipleReplies()
 				return cmd.Run()
 			},
 			Flags: []cli.Flag{
@@ -46,39 +241,61 @@ func main() {
 					Usage: "Filter received json",
 				},
 				cli.IntFlag{
-					Name:  "timeout",
-					Usage: "Timeout seconds for receiving",
-					Value: 0,
+					Name:  "count",
+					Usage: "Number of responses to output line by line (no limit if negative, or if not given with --until or --idle-timeout, and 0 is invalid)",
+					Value: 1,
+				},
+				cli.StringFlag{
+					Name:  "until",
+					Usage: "Filter to stop receiving after the matched response",
 				},
+				durationFlag("idle-timeout", "Timeout like 500ms or 2s for each next response, ending without error if passed"),
+				streamFlag,
+				durationFlag("timeout", "Timeout like 500ms or 2s for the first response (no timeout if 0)"),
+				channelFlag,
 			},
 		},
 		{
 			Name:  "notify",
 			Usage: "Send a request, but don't wait response",
 			Action: func(context *cli.Context) error {
+				factory, err := websocketClientFactory(context)
+				if err != nil {
+					return err
+				}
+				factory.Channel = context.String("channel")
 				cmd := command.NotifyCommand{
-					WebsocketClientFactory: &impl.WebsocketClientFactoryImpl{
-						Port: context.GlobalString("port"),
-					},
-					MessageFactory: &impl.MessageFactoryImpl{},
-					InputReader:    os.Stdin,
+					WebsocketClientFactory: factory,
+					MessageFactory:         &impl.MessageFactoryImpl{},
+					InputReader:            os.Stdin,
+					Stream:                 context.Bool("stream"),
+					ErrorWriter:            os.Stderr,
 				}
 				return cmd.Run()
 			},
+			Flags: []cli.Flag{
+				channelFlag,
+				streamFlag,
+			},
 		},
 		{
 			Name:  "receive",
 			Usage: "Wait receiving requests",
 			Action: func(context *cli.Context) error {
-				factory := &impl.WebsocketClientFactoryImpl{
-					Port:         context.GlobalString("port"),
-					FilterSource: context.String("filter"),
-					Debounce:     context.Int("debounce"),
+				factory, err := websocketClientFactory(context)
+				if err != nil {
+					return err
 				}
+				factory.Channel = context.String("channel")
+				factory.FilterSource = context.String("filter")
+				factory.TransformSource = context.String("transform")
+				factory.Debounce = context.Int("debounce")
+				factory.SkipRetained = context.Bool("no-retained")
 				cmd := command.ReceiveCommand{
 					WebsocketClientFactory: factory,
 					OutputWriter:           os.Stdout,
-					Timeout:                context.Int("timeout"),
+					Timeout:                duration(context.Generic("timeout")),
+					IdleTimeout:            duration(context.Generic("idle-timeout")),
 				}
 				return cmd.Run()
 			},
@@ -92,19 +309,69 @@ func main() {
 					Name:  "filter",
 					Usage: "Filter received json",
 				},
+				durationFlag("timeout", "Timeout like 500ms or 2s for the first message (no timeout if 0)"),
+				durationFlag("idle-timeout", "Timeout like 500ms or 2s for each next message, ending without error if passed"),
+				cli.StringFlag{
+					Name:  "transform",
+					Usage: "Transform received json",
+				},
+				cli.BoolFlag{
+					Name:  "no-retained",
+					Usage: "Don't receive the retained messages on joining",
+				},
+				channelFlag,
+			},
+		},
+		{
+			Name:  "connect",
+			Usage: "Send json from stdin and output received json over one connection until stdin ends",
+			Action: func(context *cli.Context) error {
+				factory, err := websocketClientFactory(context)
+				if err != nil {
+					return err
+				}
+				factory.Channel = context.String("channel")
+				factory.FilterSource = context.String("filter")
+				factory.TransformSource = context.String("transform")
+				factory.Debounce = context.Int("debounce")
+				factory.SkipRetained = context.Bool("no-retained")
+				cmd := command.ConnectCommand{
+					WebsocketClientFactory: factory,
+					MessageFactory:         &impl.MessageFactoryImpl{},
+					InputReader:            os.Stdin,
+					OutputWriter:           os.Stdout,
+					ErrorWriter:            os.Stderr,
+				}
+				return cmd.Run()
+			},
+			Flags: []cli.Flag{
 				cli.IntFlag{
-					Name:  "timeout",
-					Usage: "Timeout seconds for receiving",
+					Name:  "debounce",
+					Usage: "Debounce interval(ms)",
 					Value: 0,
 				},
+				cli.StringFlag{
+					Name:  "filter",
+					Usage: "Filter received json",
+				},
+				cli.StringFlag{
+					Name:  "transform",
+					Usage: "Transform received json",
+				},
+				cli.BoolFlag{
+					Name:  "no-retained",
+					Usage: "Don't receive the retained messages on joining",
+				},
+				channelFlag,
 			},
 		},
 		{
 			Name:  "ping",
 			Usage: "Test request to wsxhubd",
 			Action: func(context *cli.Context) error {
-				factory := &impl.WebsocketClientFactoryImpl{
-					Port: context.GlobalString("port"),
+				factory, err := websocketClientFactory(context)
+				if err != nil {
+					return err
 				}
 				cmd := command.PingCommand{
 					WebsocketClientFactory: factory,
@@ -117,32 +384,148 @@ func main() {
 			Name:  "server",
 			Usage: "Start server",
 			Action: func(context *cli.Context) error {
+				filterClauseFactory := &impl.FilterClauseFactoryImpl{}
+				configFactory := &impl.ConfigFactoryImpl{
+					FilterClauseFactory: filterClauseFactory,
+				}
+				configPath := context.String("config")
+				config, err := configFactory.Config(configPath)
+				if err != nil {
+					return err
+				}
+				overrideConfig(context, config)
+				if err := configFactory.Validate(config); err != nil {
+					return err
+				}
+
+				logLevel, err := impl.ParseLogLevel(context.String("log-level"))
+				if err != nil {
+					return err
+				}
+				logFormat, err := impl.ParseLogFormat(context.String("log-format"))
+				if err != nil {
+					return err
+				}
+				logger := impl.NewLogger(os.Stderr, logLevel, logFormat)
+
+				metrics := impl.NewMetrics()
 				outsideWorker := impl.NewWorker("outside")
 				insideWorker := impl.NewWorker("inside")
-				filterClauseFactory := &impl.FilterClauseFactoryImpl{}
-				messageFactory := &impl.MessageFactoryImpl{}
-				port := context.GlobalString("port")
+				outsideWorker.Metrics = metrics
+				insideWorker.Metrics = metrics
+				outsideWorker.Logger = logger
+				insideWorker.Logger = logger
+				insideWorker.CorrelationKey = config.CorrelationKey
+				outsideWorker.RetainKey = config.RetainKey
+				insideWorker.RetainKey = config.RetainKey
+				transformerFactory := &impl.TransformerFactoryImpl{}
+				messageFactory := &impl.MessageFactoryImpl{
+					MaxDepth:       config.MaxMessageDepth,
+					MaxBatchLength: config.MaxBatchLength,
+				}
+
+				outsideFactory, err := impl.NewServerFactory(config, config.Outside, impl.OutsideTokenEnvName)
+				if err != nil {
+					return err
+				}
+				outsideFactory.Worker = outsideWorker
+				outsideFactory.TargetWorker = insideWorker
+				outsideFactory.FilterClauseFactory = filterClauseFactory
+				outsideFactory.TransformerFactory = transformerFactory
+				outsideFactory.MessageFactory = messageFactory
+				outsideFactory.Side = outsideWorker.Name
+				outsideFactory.Metrics = metrics
+				outsideFactory.Logger = logger
+
+				insideFactory, err := impl.NewServerFactory(config, config.Inside, impl.InsideTokenEnvName)
+				if err != nil {
+					return err
+				}
+				insideFactory.Worker = insideWorker
+				insideFactory.TargetWorker = outsideWorker
+				insideFactory.FilterClauseFactory = filterClauseFactory
+				insideFactory.TransformerFactory = transformerFactory
+				insideFactory.MessageFactory = messageFactory
+				insideFactory.Side = insideWorker.Name
+				insideFactory.Metrics = metrics
+				insideFactory.Logger = logger
+				insideFactory.CorrelationKey = config.CorrelationKey
+
+				reloads := make(chan string)
+				hangups := make(chan os.Signal, 1)
+				signal.Notify(hangups, syscall.SIGHUP)
+				go func() {
+					for sig := range hangups {
+						reloads <- sig.String()
+					}
+				}()
+				if interval := context.Duration("watch-config"); interval > 0 && configPath != "" {
+					watcher := &impl.FileWatcher{Path: configPath, Interval: interval}
+					go func() {
+						for path := range watcher.Watch() {
+							reloads <- "changed " + path
+						}
+					}()
+				}
+
+				var adminFactory domain.AdminServerFactory
+				if len(config.Admin.Listen) > 0 {
+					token, err := impl.ReadToken(config.Admin.TokenFile, impl.AdminTokenEnvName)
+					if err != nil {
+						return err
+					}
+					adminFactory = &impl.AdminServerFactoryImpl{
+						Addresses: config.Admin.Listen,
+						Token:     token,
+						Workers:   []domain.Worker{insideWorker, outsideWorker},
+						Metrics:   metrics,
+						Logger:    logger,
+					}
+				}
+
+				signals := make(chan os.Signal, 1)
+				signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
 				cmd := command.ServerCommand{
-					OutsideServerFactory: &impl.ServerFactoryImpl{
-						Port:                context.String("outside"),
-						Worker:              outsideWorker,
-						TargetWorker:        insideWorker,
-						FilterClauseFactory: filterClauseFactory,
-						MessageFactory:      messageFactory,
-						HostPattern:         context.String("outside-allow"),
-					},
-					InsideServerFactory: &impl.ServerFactoryImpl{
-						Port:                port,
-						Worker:              insideWorker,
-						TargetWorker:        outsideWorker,
-						FilterClauseFactory: filterClauseFactory,
-						MessageFactory:      messageFactory,
-						HostPattern:         "localhost:" + port,
+					OutsideServerFactory: outsideFactory,
+					InsideServerFactory:  insideFactory,
+					AdminServerFactory:   adminFactory,
+					Signals:              signals,
+					ConfigReloader: &impl.ConfigReloaderImpl{
+						ConfigFactory: configFactory,
+						Path:          configPath,
+						Override: func(config *domain.Config) {
+							overrideConfig(context, config)
+						},
+						Config:               config,
+						InsideServerFactory:  insideFactory,
+						OutsideServerFactory: outsideFactory,
+						Workers:              []*impl.WorkerImpl{insideWorker, outsideWorker},
+						Logger:               logger,
 					},
+					Reloads: reloads,
+					Logger:  logger,
 				}
 				return cmd.Run()
 			},
 			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "config",
+					Usage: "json config file (the flags given explicitly take precedence, reloaded by SIGHUP)",
+				},
+				cli.StringFlag{
+					Name:  "log-level",
+					Usage: "debug (each message and delivery), info, warn or error",
+					Value: "info",
+				},
+				cli.StringFlag{
+					Name:  "log-format",
+					Usage: "text, json or logfmt",
+					Value: "text",
+				},
+				cli.DurationFlag{
+					Name:  "watch-config",
+					Usage: "interval like 1s to poll the config file for reloading (disabled if 0)",
+				},
 				cli.StringFlag{
 					Name:  "outside",
 					Usage: "port for outside",
@@ -153,12 +536,123 @@ func main() {
 					Usage: "allowed request host pattern",
 					Value: "localhost:8001",
 				},
+				cli.StringSliceFlag{
+					Name:  "outside-allow-origin",
+					Usage: "allowed Origin header like https://example.com, https://*.example.com or chrome-extension://* (only browser extensions if not given)",
+				},
+				cli.StringFlag{
+					Name:  "correlation-key",
+					Usage: "json key to stamp a correlation id on messages from `send` (disabled if empty)",
+				},
+				cli.StringFlag{
+					Name:  "retain-key",
+					Usage: "json key path (e.g. params.uri) to retain the last message per value for late joiners, up to 1000 values per channel (disabled if empty)",
+				},
+				cli.IntFlag{
+					Name:  "send-queue-size",
+					Usage: "size of the send queue per connection (sends synchronously if 0)",
+					Value: 256,
+				},
+				cli.StringFlag{
+					Name:  "send-queue-policy",
+					Usage: "policy on the full send queue: dropOldest, dropNewest or disconnect",
+					Value: string(domain.OverflowPolicyDropOldest),
+				},
+				cli.Int64Flag{
+					Name:  "max-message-size",
+					Usage: "max bytes of a received message, closing the connection with 1009 if exceeded (unlimited if 0)",
+					Value: 4 * 1024 * 1024,
+				},
+				cli.IntFlag{
+					Name:  "max-message-depth",
+					Usage: "max nesting depth of a received json message, closing the connection with 1008 if exceeded (unlimited if 0)",
+					Value: 64,
+				},
+				cli.IntFlag{
+					Name:  "max-batch-length",
+					Usage: "max maps in a received batch message, closing the connection with 1008 if exceeded (unlimited if 0)",
+					Value: 1024,
+				},
+				cli.StringFlag{
+					Name:  "tls-cert",
+					Usage: "certificate file to serve outside by wss://",
+				},
+				cli.StringFlag{
+					Name:  "tls-key",
+					Usage: "private key file to serve outside by wss://",
+				},
+				cli.StringFlag{
+					Name:  "inside-tls-cert",
+					Usage: "certificate file to serve inside by wss://",
+				},
+				cli.StringFlag{
+					Name:  "inside-tls-key",
+					Usage: "private key file to serve inside by wss://",
+				},
+				cli.StringSliceFlag{
+					Name:  "outside-listen",
+					Usage: "address to serve outside like 192.168.1.2:8001, [::1]:8001 or /path/to/socket (repeatable, overrides --outside)",
+				},
+				cli.StringSliceFlag{
+					Name:  "inside-listen",
+					Usage: "address to serve inside like 127.0.0.1:8002, [::1]:8002 or /path/to/socket (repeatable, overrides --port)",
+				},
+				cli.StringFlag{
+					Name:  "inside-socket",
+					Usage: "unix socket path to serve inside instead of --port (only the owner can connect)",
+				},
+				cli.StringSliceFlag{
+					Name:  "admin-listen",
+					Usage: "address to serve the admin api like 127.0.0.1:8003 or /path/to/socket (repeatable, disabled if not given)",
+				},
+				cli.StringFlag{
+					Name:  "admin-token-file",
+					Usage: "file that contains the token required for the admin api (default: $WSXHUB_ADMIN_TOKEN)",
+				},
+				cli.StringFlag{
+					Name:  "outside-token-file",
+					Usage: "file that contains the token required for outside (default: $WSXHUB_OUTSIDE_TOKEN)",
+				},
+				cli.StringFlag{
+					Name:  "inside-token-file",
+					Usage: "file that contains the token required for inside (default: $WSXHUB_INSIDE_TOKEN)",
+				},
 			},
 		},
+		{
+			Name:  "config",
+			Usage: "Manage the server config file",
+			Subcommands: []cli.Command{
+				{
+					Name:      "check",
+					Usage:     "Validate the config file",
+					ArgsUsage: "FILE",
+					Action: func(context *cli.Context) error {
+						path := context.Args().First()
+						if path == "" {
+							return errors.New("config file is required")
+						}
+						cmd := command.ConfigCheckCommand{
+							ConfigFactory: &impl.ConfigFactoryImpl{
+								FilterClauseFactory: &impl.FilterClauseFactoryImpl{},
+							},
+							Path:         path,
+							OutputWriter: os.Stdout,
+						}
+						return cmd.Run()
+					},
+				},
+			},
+		},
+	}
+
+	app.OnUsageError = usageError
+	for i := range app.Commands {
+		app.Commands[i].OnUsageError = usageError
 	}
 
 	if err := app.Run(os.Args); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		command.WriteError(os.Stderr, err, errorFormat.format)
+		os.Exit(command.ExitCode(err))
 	}
 }
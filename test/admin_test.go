@@ -0,0 +1,165 @@
+package command_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const adminPort = "18883"
+
+func TestAdminConnections(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsxhub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := writeToken(t, dir, "admin", "admin-secret")
+
+	cmdClient := newCommandClient(t, "receive", "--filter", `{"filters": [{"map": {"key": 1}}]}`, "--channel", "neovim")
+
+	cmdClient.startServer("--admin-listen", "127.0.0.1:"+adminPort, "--admin-token-file", tokenFile)
+	defer cmdClient.stopServer()
+
+	if err := cmdClient.cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmdClient.cmd.Process.Kill()
+	if err := cmdClient.waitToJoinServer(); err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("GET", "http://127.0.0.1:"+adminPort+"/connections", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got, want := resp.StatusCode, http.StatusOK; got != want {
+		t.Fatalf("want %v, but %v", want, got)
+	}
+
+	var body struct {
+		Connections []struct {
+			Side          string          `json:"side"`
+			Channel       string          `json:"channel"`
+			RemoteAddress string          `json:"remoteAddress"`
+			Filter        json.RawMessage `json:"filter"`
+		} `json:"connections"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(body.Connections), 1; got != want {
+		t.Fatalf("want %v, but %v", want, got)
+	}
+	conn := body.Connections[0]
+	if got, want := conn.Side, "inside"; got != want {
+		t.Errorf("want %v, but %v", want, got)
+	}
+	if got, want := conn.Channel, "neovim"; got != want {
+		t.Errorf("want %v, but %v", want, got)
+	}
+	if got, want := string(conn.Filter), `{"filters":[{"map":{"key":1}}]}`; got != want {
+		t.Errorf("want %v, but %v", want, got)
+	}
+	if conn.RemoteAddress == "" {
+		t.Error("remoteAddress should not be empty")
+	}
+}
+
+func TestAdminMetrics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsxhub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := writeToken(t, dir, "admin", "admin-secret")
+
+	cmdClient := newCommandClient(t, "notify")
+
+	cmdClient.startServer("--admin-listen", "127.0.0.1:"+adminPort, "--admin-token-file", tokenFile)
+	defer cmdClient.stopServer()
+
+	if err := cmdClient.cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	u := fmt.Sprintf("ws://localhost:%s", outsidePort)
+	ws, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	cmdClient.writeStdin(`{"id":"1"}`)
+	if _, _, err := ws.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmdClient.cmd.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	wants := []string{
+		`wsxhub_connections_joined_total{side="inside"} 1`,
+		`wsxhub_connections_joined_total{side="outside"} 1`,
+		`wsxhub_messages_received_total{worker="outside"} 1`,
+		`wsxhub_messages_delivered_total{side="outside"} 1`,
+		`wsxhub_write_duration_seconds_count{side="outside"} 1`,
+	}
+	// the delivery is counted after the client read the message
+	got := ""
+	for deadline := time.Now().Add(1 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		got = metrics(t)
+		if containsAll(got, wants) {
+			break
+		}
+	}
+	for _, want := range wants {
+		if !strings.Contains(got, want) {
+			t.Errorf("should contain %s, but %s", want, got)
+		}
+	}
+}
+
+func metrics(t *testing.T) string {
+	req, err := http.NewRequest("GET", "http://127.0.0.1:"+adminPort+"/metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got, want := resp.StatusCode, http.StatusOK; got != want {
+		t.Fatalf("want %v, but %v", want, got)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func containsAll(s string, substrs []string) bool {
+	for _, substr := range substrs {
+		if !strings.Contains(s, substr) {
+			return false
+		}
+	}
+	return true
+}
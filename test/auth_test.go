@@ -0,0 +1,75 @@
+package command_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func writeToken(t *testing.T, dir string, name string, token string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsxhub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	insideTokenFile := writeToken(t, dir, "inside", "inside-secret")
+	outsideTokenFile := writeToken(t, dir, "outside", "outside-secret")
+
+	cmdClient := newCommandClient(t, "--token-file", insideTokenFile, "ping")
+
+	cmdClient.startServer("--inside-token-file", insideTokenFile, "--outside-token-file", outsideTokenFile)
+	defer cmdClient.stopServer()
+
+	received := cmdClient.scanStdout()
+	if err := cmdClient.cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case got := <-received:
+		want := "pong"
+		if got != want {
+			t.Errorf("want %v, but %v", want, got)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatalf("output not found")
+	}
+
+	envClient := newCommandClient(t, "ping")
+	envClient.cmd.Env = append(os.Environ(), "WSXHUB_TOKEN=inside-secret")
+	if err := envClient.cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	noTokenClient := newCommandClient(t, "ping")
+	noTokenClient.cmd.Env = append(os.Environ(), "WSXHUB_TOKEN=")
+	if err := noTokenClient.cmd.Run(); err == nil {
+		t.Fatal("`wsxhub ping` must fail without token.")
+	}
+
+	outsideClient := newCommandClient(t, "--token-file", outsideTokenFile, "ping")
+	if err := outsideClient.cmd.Run(); err == nil {
+		t.Fatal("`wsxhub ping` must fail with the outside token.")
+	}
+
+	if _, _, err := websocket.DefaultDialer.Dial("ws://localhost:"+outsidePort+"/", nil); err == nil {
+		t.Fatal("outside must reject the connection without token.")
+	}
+	conn, _, err := websocket.DefaultDialer.Dial("ws://localhost:"+outsidePort+"/?token=outside-secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
@@ -0,0 +1,81 @@
+package command_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, dir string, source string) string {
+	path := filepath.Join(dir, "wsxhub.json")
+	if err := ioutil.WriteFile(path, []byte(source), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestServerConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsxhub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := writeToken(t, dir, "inside", "inside-secret")
+	configPath := writeConfig(t, dir, `{
+		"inside": {"tokenFile": "`+tokenFile+`"},
+		"outside": {"listen": ["127.0.0.1:1"]}
+	}`)
+
+	cmdClient := newCommandClient(t, "--token-file", tokenFile, "ping")
+
+	// --outside given by startServer overrides outside.listen
+	cmdClient.startServer("--config", configPath)
+	defer cmdClient.stopServer()
+
+	if err := cmdClient.cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	noTokenClient := newCommandClient(t, "ping")
+	noTokenClient.cmd.Env = append(os.Environ(), "WSXHUB_TOKEN=")
+	if err := noTokenClient.cmd.Run(); err == nil {
+		t.Fatal("`wsxhub ping` must fail without the token in the config.")
+	}
+}
+
+func TestConfigCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsxhub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	t.Run("valid", func(t *testing.T) {
+		configPath := writeConfig(t, dir, `{"outside": {"listen": ["127.0.0.1:8001"]}}`)
+
+		output, err := exec.Command("../dist/wsxhub", "config", "check", configPath).CombinedOutput()
+		if err != nil {
+			t.Fatal(err, string(output))
+		}
+
+		if got, want := string(output), "ok"; got != want {
+			t.Errorf("want %v, but %v", want, got)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		configPath := writeConfig(t, dir, `{"outside": {"listen": ["127.0.0.1"]}}`)
+
+		output, err := exec.Command("../dist/wsxhub", "config", "check", configPath).CombinedOutput()
+		if err == nil {
+			t.Fatal("`wsxhub config check` must fail if the config is invalid.")
+		}
+
+		if got, want := string(output), "outside.listen[0]: invalid listen address"; !strings.Contains(got, want) {
+			t.Errorf("should contain %s, but actual: %s", want, got)
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package command_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestConnect(t *testing.T) {
+	cmdClient := newCommandClient(t, "connect")
+
+	cmdClient.startServer()
+	defer cmdClient.stopServer()
+
+	u := fmt.Sprintf("ws://localhost:%s", outsidePort)
+	ws, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	if err := cmdClient.cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmdClient.waitToJoinServer(); err != nil {
+		t.Fatal(err)
+	}
+
+	request := `{"id":"1"}`
+	if _, err := cmdClient.stdin.Write([]byte(request + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	ws.SetReadDeadline(time.Now().Add(1 * time.Second))
+	_, message, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(message), request; got != want {
+		t.Errorf("want %v, but %v", want, got)
+	}
+
+	event := `{"method":"opened"}`
+	received := cmdClient.scanStdout()
+	if err := ws.WriteMessage(websocket.TextMessage, []byte(event)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-received:
+		if got != event {
+			t.Errorf("want %v, but %v", event, got)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	cmdClient.stdin.Close()
+	if err := cmdClient.cmd.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
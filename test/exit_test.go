@@ -0,0 +1,115 @@
+package command_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExitCode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsxhub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := writeToken(t, dir, "inside", "inside-secret")
+
+	serverClient := newCommandClient(t, "ping")
+	serverClient.startServer("--inside-token-file", tokenFile, "--max-message-size", "64")
+	defer serverClient.stopServer()
+
+	tests := []struct {
+		name      string
+		args      []string
+		input     string
+		wantCode  int
+		wantKind  string
+		wantField string
+		wantValue float64
+	}{
+		{
+			name:      "handshake rejected",
+			args:      []string{"ping"},
+			wantCode:  8,
+			wantKind:  "handshakeRejected",
+			wantField: "status",
+			wantValue: 401,
+		},
+		{
+			name:     "bad input",
+			args:     []string{"--token-file", tokenFile, "notify"},
+			input:    `{"id":`,
+			wantCode: 2,
+			wantKind: "badInput",
+		},
+		{
+			name:     "zero count",
+			args:     []string{"--token-file", tokenFile, "send", "--count", "0"},
+			input:    `{"id":"1"}`,
+			wantCode: 2,
+			wantKind: "badInput",
+		},
+		{
+			name:     "invalid filter",
+			args:     []string{"--token-file", tokenFile, "receive", "--filter", `{"map":`},
+			wantCode: 2,
+			wantKind: "badInput",
+		},
+		{
+			name:     "invalid transform",
+			args:     []string{"--token-file", tokenFile, "receive", "--transform", `{"pick": "id"}`},
+			wantCode: 2,
+			wantKind: "badInput",
+		},
+		{
+			name:      "remote closed",
+			args:      []string{"--token-file", tokenFile, "send", "--timeout", "1s"},
+			input:     `{"key":"` + strings.Repeat("a", 128) + `"}`,
+			wantCode:  9,
+			wantKind:  "remoteClosed",
+			wantField: "closeCode",
+			wantValue: 1009,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			cmdClient := newCommandClient(t, append([]string{"--error-format", "json"}, test.args...)...)
+			cmdClient.cmd.Env = append(os.Environ(), "WSXHUB_TOKEN=")
+			received := cmdClient.scanStderr()
+
+			if err := cmdClient.cmd.Start(); err != nil {
+				t.Fatal(err)
+			}
+			cmdClient.writeStdin(test.input)
+
+			// reads stderr before Wait closes it
+			select {
+			case got := <-received:
+				output := map[string]interface{}{}
+				if err := json.Unmarshal([]byte(got), &output); err != nil {
+					t.Fatalf("stderr should be json: %s", got)
+				}
+				if output["code"] != float64(test.wantCode) || output["kind"] != test.wantKind {
+					t.Errorf("want code %v and kind %v, but %v", test.wantCode, test.wantKind, got)
+				}
+				if test.wantField != "" && output[test.wantField] != test.wantValue {
+					t.Errorf("want %v %v, but %v", test.wantField, test.wantValue, got)
+				}
+			case <-time.After(1 * time.Second):
+				t.Fatal("timeout")
+			}
+
+			if err := cmdClient.cmd.Wait(); err == nil {
+				t.Fatal("should be error")
+			}
+			if got := cmdClient.cmd.ProcessState.ExitCode(); got != test.wantCode {
+				t.Errorf("want exit code %v, but %v", test.wantCode, got)
+			}
+		})
+	}
+}
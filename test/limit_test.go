@@ -0,0 +1,64 @@
+package command_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestMessageLimits(t *testing.T) {
+	cmdClient := newCommandClient(t)
+
+	cmdClient.startServer("--max-message-size", "64", "--max-message-depth", "2", "--max-batch-length", "2")
+	defer cmdClient.stopServer()
+
+	tests := []struct {
+		name    string
+		message string
+		want    int
+	}{
+		{
+			name:    "too big",
+			message: fmt.Sprintf(`{"key":"%s"}`, strings.Repeat("a", 64)),
+			want:    websocket.CloseMessageTooBig,
+		},
+		{
+			name:    "too deep",
+			message: `{"a":{"b":{}}}`,
+			want:    websocket.ClosePolicyViolation,
+		},
+		{
+			name:    "too long batch",
+			message: `[{},{},{}]`,
+			want:    websocket.ClosePolicyViolation,
+		},
+		{
+			name:    "invalid json",
+			message: `{"a":`,
+			want:    websocket.CloseInvalidFramePayloadData,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			u := fmt.Sprintf("ws://localhost:%s", outsidePort)
+			ws, _, err := websocket.DefaultDialer.Dial(u, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ws.Close()
+
+			if err := ws.WriteMessage(websocket.TextMessage, []byte(test.message)); err != nil {
+				t.Fatal(err)
+			}
+
+			_, _, err = ws.ReadMessage()
+			if !websocket.IsCloseError(err, test.want) {
+				t.Errorf("should be closed with %d, but %v", test.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package command_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestListen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsxhub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "wsxhub.sock")
+
+	cmdClient := newCommandClient(t, "ping")
+
+	cmdClient.startServer(
+		"--inside-listen", "127.0.0.1:"+insidePort,
+		"--inside-listen", socketPath,
+		"--outside-listen", "127.0.0.1:"+outsidePort,
+		"--outside-listen", "[::1]:"+outsidePort,
+	)
+	defer cmdClient.stopServer()
+
+	received := cmdClient.scanStderr()
+	if err := cmdClient.cmd.Run(); err != nil {
+		t.Fatal(err, <-received)
+	}
+
+	socketClient := newCommandClient(t, "--socket", socketPath, "ping")
+	if err := socketClient.cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	header := http.Header{"Host": {"localhost:" + outsidePort}}
+	for _, host := range []string{"127.0.0.1", "[::1]"} {
+		conn, _, err := websocket.DefaultDialer.Dial("ws://"+host+":"+outsidePort+"/", header)
+		if err != nil {
+			t.Fatalf("%s: %s", host, err)
+		}
+		conn.Close()
+	}
+}
+
+func TestListenInvalidAddress(t *testing.T) {
+	cmdClient := newCommandClient(t, "server", "--outside-listen", "127.0.0.1")
+
+	output, err := cmdClient.cmd.CombinedOutput()
+	if err == nil {
+		t.Fatal("`wsxhub server` must fail if the address is invalid.")
+	}
+	t.Log(string(output))
+}
@@ -0,0 +1,33 @@
+package command_test
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestLogFormat(t *testing.T) {
+	cmdClient := newCommandClient(t, "receive")
+
+	cmdClient.startServer("--log-format", "json")
+	defer cmdClient.stopServer()
+
+	if err := cmdClient.cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmdClient.cmd.Process.Kill()
+
+	if err := cmdClient.waitServerLog(`"level":"info","msg":"joined","worker":"inside","connection":`); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInvalidLogLevel(t *testing.T) {
+	output, err := exec.Command("../dist/wsxhub", "--port", insidePort, "server", "--log-level", "verbose").CombinedOutput()
+	if err == nil {
+		t.Fatal("should be error")
+	}
+	if got, want := string(output), "invalid log level: verbose"; !strings.Contains(got, want) {
+		t.Errorf("should contain %s, but %s", want, got)
+	}
+}
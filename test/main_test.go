@@ -105,8 +105,9 @@ func (cmdClient *commandClient) writeStdin(msg string) {
 	cmdClient.t.Logf("written: %s", msg)
 }
 
-func (cmdClient *commandClient) startServer() {
-	serverCmd := newCommandClient(cmdClient.t, "server", "--outside", outsidePort, "--outside-allow", "localhost:"+outsidePort)
+func (cmdClient *commandClient) startServer(extendedArgs ...string) {
+	baseArgs := []string{"server", "--outside", outsidePort, "--outside-allow", "localhost:" + outsidePort}
+	serverCmd := newCommandClient(cmdClient.t, append(baseArgs, extendedArgs...)...)
 
 	if err := serverCmd.cmd.Start(); err != nil {
 		panic(err)
@@ -141,22 +142,34 @@ func (cmdClient *commandClient) stopServer() {
 }
 
 func (cmdClient *commandClient) waitToJoinServer() error {
-	joined := make(chan bool)
+	return cmdClient.waitServerLog("(inside) joined")
+}
+
+func (cmdClient *commandClient) waitServerLog(pattern string) error {
+	_, err := cmdClient.scanServerLog(pattern)
+	return err
+}
+
+// scanServerLog : returns the server logs until the pattern is logged
+func (cmdClient *commandClient) scanServerLog(pattern string) ([]string, error) {
+	logged := make(chan []string)
 	go func() {
+		msgs := []string{}
 		scanner := bufio.NewScanner(cmdClient.serverCmd.stderr)
 		for scanner.Scan() {
 			msg := scanner.Text()
 			cmdClient.t.Logf("scanned: %s", msg)
-			if strings.Contains(msg, "(inside) joined") {
-				joined <- true
+			msgs = append(msgs, msg)
+			if strings.Contains(msg, pattern) {
+				logged <- msgs
 				break
 			}
 		}
 	}()
 	select {
-	case <-joined:
-		return nil
+	case msgs := <-logged:
+		return msgs, nil
 	case <-time.After(1 * time.Second):
-		return errors.New("timeout for join")
+		return nil, errors.New("timeout for log: " + pattern)
 	}
 }
@@ -2,6 +2,7 @@ package command_test
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/gorilla/websocket"
@@ -36,6 +37,16 @@ func TestNotify(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	logs, err := cmdClient.scanServerLog("(inside) left")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, log := range logs {
+		if strings.Contains(log, "ERROR") {
+			t.Errorf("should close normally, but %v", log)
+		}
+	}
+
 	got := string(message)
 	want := msg
 	if got != want {
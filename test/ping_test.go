@@ -14,8 +14,8 @@ func TestPingFailure(t *testing.T) {
 		t.Fatal("`wsxhub ping` must fail if `wsxhub server` is not executed.")
 	}
 	exitCode := cmdClient.cmd.ProcessState.ExitCode()
-	if exitCode != 1 {
-		t.Fatalf("The exit code must be 1, but actual: %d", exitCode)
+	if exitCode != 3 {
+		t.Fatalf("The exit code must be 3, but actual: %d", exitCode)
 	}
 
 	select {
@@ -45,3 +45,147 @@ func TestReceive(t *testing.T) {
 		t.Fatal("timeout")
 	}
 }
+
+func TestReceiveRetained(t *testing.T) {
+	cmdClient := newCommandClient(t, "receive")
+
+	cmdClient.startServer("--retain-key", "id", "--log-level", "debug")
+	defer cmdClient.stopServer()
+
+	u := fmt.Sprintf("ws://localhost:%s", outsidePort)
+	ws, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	message := `{"id":"1"}`
+	if err := ws.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmdClient.waitServerLog("DEBUG (inside) received"); err != nil {
+		t.Fatal(err)
+	}
+
+	received := cmdClient.scanStdout()
+	if err := cmdClient.cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case got := <-received:
+		want := message
+		if got != want {
+			t.Errorf("want %v, but %v", want, got)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestReceiveTransformed(t *testing.T) {
+	cmdClient := newCommandClient(t, "receive", "--transform", `{"pick": ["id"], "unwrap": true}`)
+
+	cmdClient.startServer()
+	defer cmdClient.stopServer()
+
+	if err := cmdClient.cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmdClient.waitToJoinServer(); err != nil {
+		t.Fatal(err)
+	}
+
+	received := cmdClient.scanStdout()
+
+	u := fmt.Sprintf("ws://localhost:%s", outsidePort)
+	ws, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	message := `[{"id":"1","text":"large"},{"id":"2"}]`
+	if err := ws.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case got := <-received:
+		want := `{"id":"1"}`
+		if got != want {
+			t.Errorf("want %v, but %v", want, got)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestReceiveChannel(t *testing.T) {
+	cmdClient := newCommandClient(t, "receive", "--channel", "neovim")
+
+	cmdClient.startServer()
+	defer cmdClient.stopServer()
+
+	if err := cmdClient.cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmdClient.waitToJoinServer(); err != nil {
+		t.Fatal(err)
+	}
+
+	received := cmdClient.scanStdout()
+
+	for _, path := range []string{"/ch/vscode", "/", "/ch/neovim"} {
+		u := fmt.Sprintf("ws://localhost:%s%s", outsidePort, path)
+		ws, _, err := websocket.DefaultDialer.Dial(u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+
+		message := fmt.Sprintf(`{"path":"%s"}`, path)
+		if err := ws.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case got := <-received:
+		want := `{"path":"/ch/neovim"}`
+		if got != want {
+			t.Errorf("want %v, but %v", want, got)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestReceiveReplyTimeout(t *testing.T) {
+	cmdClient := newCommandClient(t, "receive", "--timeout", "100ms")
+
+	cmdClient.startServer()
+	defer cmdClient.stopServer()
+
+	received := cmdClient.scanStderr()
+
+	if err := cmdClient.cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case got := <-received:
+		if want := "reply timeout"; got != want {
+			t.Errorf("want %v, but %v", want, got)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	if err := cmdClient.cmd.Wait(); err == nil {
+		t.Fatal("should be error")
+	}
+	if got, want := cmdClient.cmd.ProcessState.ExitCode(), 6; got != want {
+		t.Errorf("want exit code %v, but %v", want, got)
+	}
+}
@@ -0,0 +1,94 @@
+package command_test
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestReloadBySignal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsxhub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := writeToken(t, dir, "inside", "old-secret")
+	configPath := writeConfig(t, dir, `{"inside": {"tokenFile": "`+tokenFile+`"}}`)
+	oldTokenFile := writeToken(t, dir, "old", "old-secret")
+	newTokenFile := writeToken(t, dir, "new", "new-secret")
+
+	cmdClient := newCommandClient(t, "--token-file", oldTokenFile, "receive")
+
+	cmdClient.startServer("--config", configPath)
+	defer cmdClient.stopServer()
+
+	received := cmdClient.scanStdout()
+	if err := cmdClient.cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmdClient.waitToJoinServer(); err != nil {
+		t.Fatal(err)
+	}
+
+	writeToken(t, dir, "inside", "new-secret")
+	if err := cmdClient.serverCmd.cmd.Process.Signal(syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmdClient.waitServerLog("reloaded config changes=inside.token"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := newCommandClient(t, "--token-file", newTokenFile, "ping").cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := newCommandClient(t, "--token-file", oldTokenFile, "ping").cmd.Run(); err == nil {
+		t.Fatal("`wsxhub ping` must fail with the old token.")
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://localhost:"+outsidePort, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"key":"value"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case got := <-received:
+		want := `{"key":"value"}`
+		if got != want {
+			t.Errorf("want %v, but %v", want, got)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("the existing connection must be kept")
+	}
+}
+
+func TestReloadByWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsxhub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configPath := writeConfig(t, dir, `{}`)
+
+	cmdClient := newCommandClient(t)
+
+	cmdClient.startServer("--config", configPath, "--watch-config", "10ms")
+	defer cmdClient.stopServer()
+
+	writeConfig(t, dir, `{"outside": {"allowOrigins": ["chrome-extension://*"]}}`)
+	if err := cmdClient.waitServerLog("reloaded config changes=outside.allowOrigins"); err != nil {
+		t.Fatal(err)
+	}
+
+	writeConfig(t, dir, `{"outside": {"allowOrigins": ["example.com"]}}`)
+	if err := cmdClient.waitServerLog("ERROR rejected config "); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -2,6 +2,7 @@ package command_test
 
 import (
 	"fmt"
+	"io/ioutil"
 	"testing"
 	"time"
 
@@ -38,10 +39,6 @@ func TestSend(t *testing.T) {
 
 	sent := cmdClient.scanStdout()
 
-	if err := cmdClient.cmd.Wait(); err != nil {
-		t.Fatal(err)
-	}
-
 	select {
 	case got := <-sent:
 		want := string(message)
@@ -51,6 +48,10 @@ func TestSend(t *testing.T) {
 	case <-time.After(1 * time.Second):
 		t.Fatal("timeout")
 	}
+
+	if err := cmdClient.cmd.Wait(); err != nil {
+		t.Fatal(err)
+	}
 }
 
 func TestBatchSend(t *testing.T) {
@@ -84,10 +85,6 @@ func TestBatchSend(t *testing.T) {
 
 	sent := cmdClient.scanStdout()
 
-	if err := cmdClient.cmd.Wait(); err != nil {
-		t.Fatal(err)
-	}
-
 	want := string(message)
 	select {
 	case got := <-sent:
@@ -97,4 +94,121 @@ func TestBatchSend(t *testing.T) {
 	case <-time.After(1 * time.Second):
 		t.Fatal("timeout")
 	}
+
+	if err := cmdClient.cmd.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCorrelatedSend(t *testing.T) {
+	cmdClient := newCommandClient(t, "send")
+	otherCmdClient := newCommandClient(t, "send")
+
+	cmdClient.startServer("--correlation-key", "id")
+	defer cmdClient.stopServer()
+
+	u := fmt.Sprintf("ws://localhost:%s", outsidePort)
+	ws, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	requests := [][]byte{}
+	inputs := []string{}
+	for _, c := range []*commandClient{cmdClient, otherCmdClient} {
+		if err := c.cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		input := fmt.Sprintf(`{"id":"1","name":"%p"}`, c)
+		inputs = append(inputs, input)
+		c.writeStdin(input)
+
+		_, message, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		requests = append(requests, message)
+	}
+	if string(requests[0]) == string(requests[1]) {
+		t.Fatalf("should stamp the different ids, but actual: %s", requests[0])
+	}
+
+	sent := cmdClient.scanStdout()
+	otherSent := otherCmdClient.scanStdout()
+
+	for i := len(requests) - 1; i >= 0; i-- {
+		if err := ws.WriteMessage(websocket.TextMessage, requests[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, received := range []chan string{sent, otherSent} {
+		select {
+		case got := <-received:
+			// the reply has the original id of the request
+			want := inputs[i]
+			if got != want {
+				t.Errorf("want %v, but %v", want, got)
+			}
+		case <-time.After(1 * time.Second):
+			t.Fatal("timeout")
+		}
+	}
+
+	for _, c := range []*commandClient{cmdClient, otherCmdClient} {
+		if err := c.cmd.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSendUntil(t *testing.T) {
+	cmdClient := newCommandClient(t, "send", "--until", `{"filters": [{"map": {"done": true}}]}`)
+
+	cmdClient.startServer("--correlation-key", "id")
+	defer cmdClient.stopServer()
+
+	if err := cmdClient.cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	u := fmt.Sprintf("ws://localhost:%s", outsidePort)
+	ws, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	cmdClient.writeStdin(`{"method":"build"}`)
+
+	var request struct {
+		ID string `json:"id"`
+	}
+	if err := ws.ReadJSON(&request); err != nil {
+		t.Fatal(err)
+	}
+
+	replies := []string{
+		fmt.Sprintf(`{"id":"%s","progress":50}`, request.ID),
+		fmt.Sprintf(`{"id":"%s","done":true}`, request.ID),
+	}
+	for _, reply := range replies {
+		if err := ws.WriteMessage(websocket.TextMessage, []byte(reply)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	output, err := ioutil.ReadAll(cmdClient.stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmdClient.cmd.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the stamped id is removed because the request had no id
+	if got, want := string(output), "{\"progress\":50}\n{\"done\":true}\n"; got != want {
+		t.Errorf("want %v, but %v", want, got)
+	}
 }
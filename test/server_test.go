@@ -0,0 +1,62 @@
+package command_test
+
+import (
+	"net"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestServerShutdown(t *testing.T) {
+	cmdClient := newCommandClient(t, "receive")
+
+	cmdClient.startServer()
+
+	if err := cmdClient.cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmdClient.waitToJoinServer(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cmdClient.serverCmd.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+
+	exited := make(chan error)
+	go func() {
+		if err := cmdClient.cmd.Wait(); err != nil {
+			exited <- err
+			return
+		}
+		exited <- cmdClient.serverCmd.cmd.Wait()
+	}()
+
+	select {
+	case err := <-exited:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestServerPortInUse(t *testing.T) {
+	listener, err := net.Listen("tcp", ":"+outsidePort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	output, err := exec.Command("../dist/wsxhub", "--port", insidePort, "server", "--outside", outsidePort).CombinedOutput()
+	if err == nil {
+		t.Fatal("`wsxhub server` must fail if the port is in use.")
+	}
+
+	if got, want := string(output), "address already in use"; !strings.Contains(got, want) {
+		t.Errorf("should contain %s, but actual: %s", want, got)
+	}
+}
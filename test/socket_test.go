@@ -0,0 +1,79 @@
+package command_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsxhub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "wsxhub.sock")
+
+	cmdClient := newCommandClient(t, "--socket", socketPath, "ping")
+
+	cmdClient.startServer("--inside-socket", socketPath)
+	defer cmdClient.stopServer()
+
+	info, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := info.Mode().Perm(), os.FileMode(0600); got != want {
+		t.Errorf("want %v, but %v", want, got)
+	}
+
+	received := cmdClient.scanStdout()
+	if err := cmdClient.cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// reads stdout before Wait closes it
+	select {
+	case got := <-received:
+		want := "pong"
+		if got != want {
+			t.Errorf("want %v, but %v", want, got)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatalf("output not found")
+	}
+
+	if err := cmdClient.cmd.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSocketStale(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsxhub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "wsxhub.sock")
+
+	crashed := newCommandClient(t)
+	crashed.startServer("--inside-socket", socketPath)
+	crashed.stopServer()
+	if err := crashed.serverCmd.cmd.Wait(); err == nil {
+		t.Fatal("the server must be killed")
+	}
+	if _, err := os.Stat(socketPath); err != nil {
+		t.Fatalf("the killed server must leave the socket: %s", err)
+	}
+
+	cmdClient := newCommandClient(t, "--socket", socketPath, "ping")
+
+	cmdClient.startServer("--inside-socket", socketPath)
+	defer cmdClient.stopServer()
+
+	if err := cmdClient.cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,100 @@
+package command_test
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestNotifyStream(t *testing.T) {
+	cmdClient := newCommandClient(t, "notify", "--stream")
+
+	cmdClient.startServer()
+	defer cmdClient.stopServer()
+
+	if err := cmdClient.cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	u := fmt.Sprintf("ws://localhost:%s", outsidePort)
+	ws, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	// each message arrives before the input ends
+	for _, msg := range []string{`{"id":"1"}`, `{"id":"2"}`, "{\n\"items\":\n[1, 2]\n}"} {
+		if _, err := cmdClient.stdin.Write([]byte(msg + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		ws.SetReadDeadline(time.Now().Add(1 * time.Second))
+		_, message, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(message), msg; got != want {
+			t.Errorf("want %v, but %v", want, got)
+		}
+	}
+
+	cmdClient.writeStdin("{\"id\":\n")
+	stderr, err := ioutil.ReadAll(cmdClient.stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmdClient.cmd.Wait(); err == nil {
+		t.Error("should be error by the invalid message")
+	}
+	if got, want := string(stderr), "line 7: invalid json: unexpected end of JSON input\n"; !strings.HasPrefix(got, want) {
+		t.Errorf("want %v, but %v", want, got)
+	}
+}
+
+func TestSendStream(t *testing.T) {
+	cmdClient := newCommandClient(t, "send", "--stream")
+
+	cmdClient.startServer()
+	defer cmdClient.stopServer()
+
+	if err := cmdClient.cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	u := fmt.Sprintf("ws://localhost:%s", outsidePort)
+	ws, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	cmdClient.writeStdin(`{"id":"1"}{"id":"2"}`)
+
+	for i := 0; i < 2; i++ {
+		_, message, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ws.WriteMessage(websocket.TextMessage, message); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scanner := bufio.NewScanner(cmdClient.stdout)
+	replies := []string{}
+	for scanner.Scan() {
+		replies = append(replies, scanner.Text())
+	}
+	if err := cmdClient.cmd.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := fmt.Sprint(replies), `[{"id":"1"} {"id":"2"}]`; got != want {
+		t.Errorf("want %v, but %v", want, got)
+	}
+}